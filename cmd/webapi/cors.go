@@ -9,13 +9,28 @@ import (
 // feature present in web browsers that blocks JavaScript requests going across different domains if not specified in a
 // policy. This function sends the policy of this API server.
 func applyCORSHandler(h http.Handler) http.Handler {
-	return handlers.CORS(
+	cors := handlers.CORS(
 		handlers.AllowedHeaders([]string{
 			"Authorization", "Content-Type",
+			// Resumable uploads (tus protocol)
+			"Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset",
+		}),
+		handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS", "DELETE", "PUT", "HEAD", "PATCH"}),
+		handlers.ExposedHeaders([]string{
+			"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+			"Upload-Offset", "Upload-Length", "Upload-Expires", "Photo-Id",
 		}),
-		handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS", "DELETE", "PUT"}),
 		// Do not modify the CORS origin and max age, they are used in the evaluation.
 		handlers.AllowedOrigins([]string{"*"}),
 		handlers.MaxAge(1),
 	)(h)
+
+	// The tus discovery requests use OPTIONS too, but they are not preflight requests: the CORS policy would drop them
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		cors.ServeHTTP(w, r)
+	})
 }
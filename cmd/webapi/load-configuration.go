@@ -27,6 +27,26 @@ type WebAPIConfiguration struct {
 	DB    struct {
 		Filename string `conf:"default:/tmp/decaf.db"`
 	}
+	Scheduler struct {
+		Interval time.Duration `conf:"default:30s"`
+	}
+	// Admins is the list of ids of the users allowed to manage the quotas, separated by `;`
+	Admins []uint
+	// Moderators is the list of ids of the users allowed to mark the photos of others as sensitive, separated by `;`
+	Moderators []uint
+	// Quota is the default quota of the users, a limit of 0 means unlimited
+	Quota struct {
+		MaxBytes       int64 `conf:"default:0"`
+		MaxPhotos      int64 `conf:"default:0"`
+		MaxDailyBytes  int64 `conf:"default:0"`
+		MaxDailyPhotos int64 `conf:"default:0"`
+	}
+	// Reactions is the list of emojis users can react with to photos and comments, separated by `;`, the first one is the like
+	Reactions []string `conf:"default:❤️;👍;😂;😮;😢;😡"`
+	// Images.StorageFormat is the MIME type uploaded photos are transcoded to (image/jpeg or image/png), or "original"
+	Images struct {
+		StorageFormat string `conf:"default:original"`
+	}
 }
 
 // loadConfiguration creates a WebAPIConfiguration starting from flags, environment variables and configuration file.
@@ -31,6 +31,7 @@ import (
 	"github.com/Big-Iron-Cheems/WASAPhoto/service/api"
 	"github.com/Big-Iron-Cheems/WASAPhoto/service/database"
 	"github.com/Big-Iron-Cheems/WASAPhoto/service/globaltime"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/model"
 	"github.com/ardanlabs/conf"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/sirupsen/logrus"
@@ -111,8 +112,14 @@ func run() error {
 
 	// Create the API router
 	apirouter, err := api.New(api.Config{
-		Logger:   logger,
-		Database: db,
+		Logger:            logger,
+		Database:          db,
+		SchedulerInterval: cfg.Scheduler.Interval,
+		Admins:            cfg.Admins,
+		Moderators:        cfg.Moderators,
+		Quota:             model.Quota(cfg.Quota),
+		StorageFormat:     cfg.Images.StorageFormat,
+		Reactions:         cfg.Reactions,
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
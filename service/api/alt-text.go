@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// missingAltTextWarning is the warning returned when a photo is uploaded without alt text.
+const missingAltTextWarning = "the photo has no alt text, add one to make it accessible to the users of screen readers"
+
+// maxSearchQueryLength is the maximum length, in characters, of a photo search query.
+const maxSearchQueryLength = 64
+
+// uploadedPhoto is the response of a photo upload, the photo along with the warnings about it.
+type uploadedPhoto struct {
+	Photo
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// photoWarnings is a helper function to list the issues of a photo that do not prevent its upload.
+func photoWarnings(photo Photo) []string {
+	var warnings []string
+	if photo.AltText == "" {
+		warnings = append(warnings, missingAltTextWarning)
+	}
+	return warnings
+}
+
+/*
+setPhotoAltText Replace the alt text of a photo, an empty one removes it.
+Only the owner of the photo can change it.
+
+	curl -X PUT BASE_URL/users/USERNAME/photos/PHOTO_ID/alt-text -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json' -d '{"altText": "ALT_TEXT"}'
+*/
+func (rt *_router) setPhotoAltText(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var body struct {
+		AltText string `json:"altText"`
+	}
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the photo's data from the db
+	photoIdUint64, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	photo, err := rt.db.GetPhoto(uint(photoIdUint64))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if photo.OwnerId != header {
+		respondWithJSONError(w, "only the owner of the photo can change its alt text", http.StatusForbidden)
+		return
+	}
+
+	// Get the alt text from the request body
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	altText := strings.TrimSpace(body.AltText)
+	if err = validateString(altTextPattern, altText); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Update the photo
+	err = rt.db.SetPhotoAltText(photo.PhotoId, altText)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	photo.AltText = altText
+
+	// Return the updated photo
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(photo)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+searchPhotos Get the photos whose alt text or caption contains the given text, newest first.
+Only the photos visible to the requester are returned.
+
+	curl -X GET 'BASE_URL/photos/search?q=TEXT' -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) searchPhotos(w http.ResponseWriter, r *http.Request, _ httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the query
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" || utf8.RuneCountInString(query) > maxSearchQueryLength {
+		respondWithJSONError(w, "q must be between 1 and "+strconv.Itoa(maxSearchQueryLength)+" characters", http.StatusBadRequest)
+		return
+	}
+
+	// Get the matching photos from the db
+	photos, err := rt.db.SearchPhotos(query, header, maxSearchResults)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Apply the sensitive media setting of the requester
+	photos, err = rt.filterSensitive(header, photos)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the photos in the response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(photos)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
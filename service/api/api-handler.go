@@ -27,6 +27,7 @@ func (rt *_router) Handler() http.Handler {
 	rt.router.GET("/users/:username/following/list", rt.wrap(rt.getFollowingList))
 	rt.router.POST("/users/:username/followers", rt.wrap(rt.followUser))
 	rt.router.DELETE("/users/:username/followers/:targetUsername", rt.wrap(rt.unfollowUser))
+	rt.router.GET("/users/:username/suggestions", rt.wrap(rt.getSuggestions))
 
 	// Photo operations
 	rt.router.GET("/users/:username/photos", rt.wrap(rt.getPhotoList))
@@ -42,6 +43,100 @@ func (rt *_router) Handler() http.Handler {
 	rt.router.GET("/users/:username/photos/:photoId/comments", rt.wrap(rt.getPhotoComments))
 	rt.router.POST("/users/:username/photos/:photoId/comments", rt.wrap(rt.commentPhoto))
 	rt.router.DELETE("/users/:username/photos/:photoId/comments/:commentId", rt.wrap(rt.uncommentPhoto))
+	rt.router.PATCH("/users/:username/photos/:photoId/comments/:commentId", rt.wrap(rt.editComment))
+	rt.router.GET("/users/:username/photos/:photoId/comments/:commentId/history", rt.wrap(rt.getCommentHistory))
+	rt.router.GET("/users/:username/photos/:photoId/comments/:commentId/replies", rt.wrap(rt.getCommentReplies))
+	rt.router.POST("/users/:username/photos/:photoId/comments/:commentId/replies", rt.wrap(rt.replyToComment))
+
+	// Comment moderation operations
+	rt.router.PUT("/users/:username/photos/:photoId/comments/:commentId/pin", rt.wrap(rt.pinComment))
+	rt.router.DELETE("/users/:username/photos/:photoId/comments/:commentId/pin", rt.wrap(rt.unpinComment))
+	rt.router.PUT("/users/:username/photos/:photoId/lock", rt.wrap(rt.lockComments))
+	rt.router.DELETE("/users/:username/photos/:photoId/lock", rt.wrap(rt.unlockComments))
+
+	// Hidden words operations
+	rt.router.GET("/users/:username/hidden-words", rt.wrap(rt.getHiddenWords))
+	rt.router.PUT("/users/:username/hidden-words", rt.wrap(rt.setHiddenWords))
+	rt.router.GET("/users/:username/hidden-comments", rt.wrap(rt.getHiddenComments))
+	rt.router.PUT("/users/:username/photos/:photoId/comments/:commentId/approval", rt.wrap(rt.approveComment))
+
+	// Reaction operations
+	rt.router.PUT("/users/:username/photos/:photoId/comments/:commentId/reaction", rt.wrap(rt.reactToComment))
+	rt.router.DELETE("/users/:username/photos/:photoId/comments/:commentId/reaction", rt.wrap(rt.unreactToComment))
+	rt.router.GET("/reactions", rt.wrap(rt.getReactions))
+	rt.router.PUT("/users/:username/photos/:photoId/reaction", rt.wrap(rt.reactToPhoto))
+	rt.router.DELETE("/users/:username/photos/:photoId/reaction", rt.wrap(rt.unlikePhoto))
+
+	// Location operations
+	rt.router.GET("/photos/nearby", rt.wrap(rt.getPhotosNearby))
+	rt.router.GET("/photos/area", rt.wrap(rt.getPhotosInArea))
+
+	// Mention operations
+	rt.router.GET("/users/:username/mentions", rt.wrap(rt.getMentionedPhotos))
+
+	// Tag operations
+	rt.router.GET("/users/:username/tagged", rt.wrap(rt.getTaggedPhotos))
+	rt.router.GET("/users/:username/photos/:photoId/tags", rt.wrap(rt.getPhotoTags))
+	rt.router.PUT("/users/:username/photos/:photoId/tags/:targetUsername", rt.wrap(rt.tagUser))
+	rt.router.DELETE("/users/:username/photos/:photoId/tags/:targetUsername", rt.wrap(rt.untagUser))
+
+	// Upload operations
+	rt.router.OPTIONS("/users/:username/uploads", rt.wrap(rt.getUploadOptions))
+	rt.router.POST("/users/:username/uploads", rt.wrap(rt.createUpload))
+	rt.router.HEAD("/users/:username/uploads/:uploadId", rt.wrap(rt.getUploadOffset))
+	rt.router.PATCH("/users/:username/uploads/:uploadId", rt.wrap(rt.resumeUpload))
+	rt.router.DELETE("/users/:username/uploads/:uploadId", rt.wrap(rt.deleteUpload))
+
+	// Quota operations
+	rt.router.GET("/users/:username/quota", rt.wrap(rt.getQuota))
+	rt.router.PUT("/users/:username/quota", rt.wrap(rt.setQuota))
+	rt.router.DELETE("/users/:username/quota", rt.wrap(rt.deleteQuota))
+
+	// Edit operations
+	rt.router.POST("/users/:username/photos/:photoId/edits", rt.wrap(rt.editPhoto))
+
+	// Schedule operations
+	rt.router.GET("/users/:username/scheduled", rt.wrap(rt.getScheduledPhotos))
+
+	// Archive operations
+	rt.router.GET("/users/:username/archive", rt.wrap(rt.getArchivedPhotos))
+	rt.router.PUT("/users/:username/archive/:photoId", rt.wrap(rt.archivePhoto))
+	rt.router.DELETE("/users/:username/archive/:photoId", rt.wrap(rt.unarchivePhoto))
+
+	// Collection operations
+	rt.router.GET("/users/:username/collections", rt.wrap(rt.getCollections))
+	rt.router.POST("/users/:username/collections", rt.wrap(rt.createCollection))
+	rt.router.PUT("/users/:username/collections/:collectionId", rt.wrap(rt.renameCollection))
+	rt.router.DELETE("/users/:username/collections/:collectionId", rt.wrap(rt.deleteCollection))
+	rt.router.PUT("/users/:username/collections/:collectionId/order", rt.wrap(rt.reorderCollection))
+	rt.router.GET("/users/:username/collections/:collectionId/photos", rt.wrap(rt.getCollectionPhotos))
+	rt.router.PUT("/users/:username/collections/:collectionId/photos/:photoId", rt.wrap(rt.addToCollection))
+	rt.router.DELETE("/users/:username/collections/:collectionId/photos/:photoId", rt.wrap(rt.removeFromCollection))
+
+	// Image operations
+	rt.router.GET("/users/:username/photos/:photoId/image", rt.wrap(rt.getPhotoImage))
+
+	// Alt text operations
+	rt.router.PUT("/users/:username/photos/:photoId/alt-text", rt.wrap(rt.setPhotoAltText))
+	rt.router.GET("/photos/search", rt.wrap(rt.searchPhotos))
+
+	// Sensitive media operations
+	rt.router.PUT("/users/:username/photos/:photoId/sensitive", rt.wrap(rt.markSensitive))
+	rt.router.DELETE("/users/:username/photos/:photoId/sensitive", rt.wrap(rt.unmarkSensitive))
+	rt.router.GET("/users/:username/settings", rt.wrap(rt.getSettings))
+	rt.router.PUT("/users/:username/settings", rt.wrap(rt.setSettings))
+
+	// Story operations
+	rt.router.GET("/stories", rt.wrap(rt.getFollowedStories))
+	rt.router.GET("/users/:username/stories", rt.wrap(rt.getUserStories))
+	rt.router.POST("/users/:username/stories", rt.wrap(rt.createStory))
+	rt.router.DELETE("/users/:username/stories/:storyId", rt.wrap(rt.deleteStory))
+	rt.router.GET("/users/:username/stories/:storyId/image", rt.wrap(rt.getStoryImage))
+	rt.router.GET("/users/:username/stories/:storyId/views", rt.wrap(rt.getStoryViews))
+	rt.router.POST("/users/:username/stories/:storyId/views", rt.wrap(rt.viewStory))
+
+	// View operations
+	rt.router.GET("/users/:username/photos/:photoId/stats", rt.wrap(rt.getPhotoStats))
 
 	// Special routes
 	rt.router.GET("/liveness", rt.wrap(rt.liveness))
@@ -38,10 +38,15 @@ package api
 
 import (
 	"errors"
+	"fmt"
 	"github.com/Big-Iron-Cheems/WASAPhoto/service/database"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/imaging"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/model"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"sync"
+	"time"
 )
 
 // Config is used to provide dependencies and configuration to the New function.
@@ -51,6 +56,24 @@ type Config struct {
 
 	// Database is the instance of database.AppDatabase where data are saved
 	Database database.AppDatabase
+
+	// SchedulerInterval is how often scheduled photos are checked for publishing, defaults to 30 seconds
+	SchedulerInterval time.Duration
+
+	// Admins is the list of ids of the users allowed to manage the quotas, they are moderators too
+	Admins []uint
+
+	// Moderators is the list of ids of the users allowed to mark the photos of others as sensitive
+	Moderators []uint
+
+	// Quota is the default quota of the users
+	Quota model.Quota
+
+	// StorageFormat is the MIME type photos are transcoded to when uploaded, or "original" to store them as they are
+	StorageFormat string
+
+	// Reactions is the list of emojis users can react with to photos and comments, the first one is the like
+	Reactions []string
 }
 
 // Router is the package API interface representing an API handler builder
@@ -78,11 +101,66 @@ func New(cfg Config) (Router, error) {
 	router.RedirectTrailingSlash = false
 	router.RedirectFixedPath = false
 
-	return &_router{
+	if cfg.SchedulerInterval <= 0 {
+		cfg.SchedulerInterval = 30 * time.Second
+	}
+
+	if cfg.StorageFormat == "" {
+		cfg.StorageFormat = storeOriginal
+	}
+	if cfg.StorageFormat != storeOriginal && !imaging.CanEncode(cfg.StorageFormat) {
+		return nil, fmt.Errorf("unsupported storage format %q, must be %q, %q or %q", cfg.StorageFormat, storeOriginal, imaging.JPEG, imaging.PNG)
+	}
+
+	if len(cfg.Reactions) == 0 {
+		cfg.Reactions = defaultReactions
+	}
+	seenReactions := make(map[string]bool, len(cfg.Reactions))
+	for _, reaction := range cfg.Reactions {
+		if err := validateString(reactionPattern, reaction); err != nil || seenReactions[reaction] {
+			return nil, fmt.Errorf("invalid reaction %q, reactions must be distinct emojis", reaction)
+		}
+		seenReactions[reaction] = true
+	}
+
+	// The reactions stored before the available ones changed become likes, as they could not be changed otherwise
+	replaced, err := cfg.Database.ReplaceUnknownReactions(cfg.Reactions)
+	if err != nil {
+		return nil, fmt.Errorf("replacing the reactions no longer available: %w", err)
+	}
+	if replaced > 0 {
+		cfg.Logger.WithField("reactions", replaced).Warn("reactions no longer available replaced with likes")
+	}
+
+	admins := make(map[uint]bool, len(cfg.Admins))
+	for _, userId := range cfg.Admins {
+		admins[userId] = true
+	}
+
+	moderators := make(map[uint]bool, len(cfg.Moderators))
+	for _, userId := range cfg.Moderators {
+		moderators[userId] = true
+	}
+
+	rt := &_router{
 		router:     router,
 		baseLogger: cfg.Logger,
 		db:         cfg.Database,
-	}, nil
+		admins:     admins,
+		moderators: moderators,
+		quota:      cfg.Quota,
+		storage:    cfg.StorageFormat,
+		reactions:  cfg.Reactions,
+		done:       make(chan struct{}),
+	}
+
+	// Start the background workers, they are stopped by Close
+	rt.runPeriodically("scheduler", cfg.SchedulerInterval, rt.publishScheduledPhotos)
+	rt.runPeriodically("uploads", uploadReapInterval, rt.deleteExpiredUploads)
+	rt.runPeriodically("stories", storyReapInterval, rt.deleteExpiredStories)
+	rt.runPeriodically("views", viewFlushInterval, rt.flushViews)
+
+	return rt, nil
 }
 
 type _router struct {
@@ -93,4 +171,25 @@ type _router struct {
 	baseLogger logrus.FieldLogger
 
 	db database.AppDatabase
+
+	// admins is the set of ids of the users allowed to manage the quotas, and quota is the default one.
+	admins map[uint]bool
+	quota  model.Quota
+
+	// moderators is the set of ids of the users allowed to mark the photos of others as sensitive.
+	moderators map[uint]bool
+
+	// storage is the MIME type uploaded photos are transcoded to, or storeOriginal.
+	storage string
+
+	// reactions is the list of emojis users can react with, the first one is the like.
+	reactions []string
+
+	// views buffers the views of the photos until the next flush.
+	views viewBuffer
+
+	// done is closed by Close to stop the background workers, and workers tracks the ones still running.
+	done      chan struct{}
+	workers   sync.WaitGroup
+	closeOnce sync.Once
 }
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+)
+
+/*
+getArchivedPhotos Get the list of photos archived by the user.
+Only the owner of the archive can see it.
+
+	curl -X GET BASE_URL/users/USERNAME/archive -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getArchivedPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var user User
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the username
+	user.Username = ps.ByName("username")
+	if err = validateString(usernamePattern, user.Username); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the user's data from the db
+	user, err = rt.db.GetUserProfile(user)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if user.UserId != header {
+		respondWithJSONError(w, "only the owner can see their archive", http.StatusForbidden)
+		return
+	}
+
+	// Get the archived photos from the db
+	photos, err := rt.db.GetArchivedPhotos(user.UserId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the photos in the response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(photos)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+archivePhoto Hide a photo from the profile and the streams of the followers, without deleting it.
+
+	curl -X PUT BASE_URL/users/USERNAME/archive/PHOTO_ID -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) archivePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	rt.setPhotoArchived(w, r, ps, true)
+}
+
+/*
+unarchivePhoto Restore an archived photo.
+
+	curl -X DELETE BASE_URL/users/USERNAME/archive/PHOTO_ID -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) unarchivePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	rt.setPhotoArchived(w, r, ps, false)
+}
+
+// setPhotoArchived Change the archived state of a photo of the requester.
+func (rt *_router) setPhotoArchived(w http.ResponseWriter, r *http.Request, ps httprouter.Params, archived bool) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the photo's data from the db
+	photoIdUint64, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	photo, err := rt.db.GetPhoto(uint(photoIdUint64))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if photo.OwnerId != header {
+		respondWithJSONError(w, "only the owner of the photo can archive it", http.StatusForbidden)
+		return
+	}
+
+	// Update the photo
+	err = rt.db.SetPhotoArchived(photo.PhotoId, archived)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+}
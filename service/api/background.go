@@ -0,0 +1,33 @@
+package api
+
+import (
+	"time"
+)
+
+/*
+runPeriodically Start a background worker calling task every interval, until the router is closed.
+Errors returned by the task are logged and do not stop the worker.
+*/
+func (rt *_router) runPeriodically(name string, interval time.Duration, task func() error) {
+	logger := rt.baseLogger.WithField("worker", name)
+
+	rt.workers.Add(1)
+	go func() {
+		defer rt.workers.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-rt.done:
+				logger.Debug("worker stopped")
+				return
+			case <-ticker.C:
+				if err := task(); err != nil {
+					logger.WithError(err).Error("background task failed")
+				}
+			}
+		}
+	}()
+}
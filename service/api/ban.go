@@ -11,7 +11,7 @@ import (
 /*
 getBansList Get the list of users a user has banned via username.
 
-	curl -X GET BASE_URL/users/USERNAME/bans/list -H 'Authorization : Bearer USER_ID'
+	curl -X GET 'BASE_URL/users/USERNAME/bans/list?cursor=CURSOR&limit=LIMIT' -H 'Authorization : Bearer USER_ID'
 */
 func (rt *_router) getBansList(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
 	var user User
@@ -25,21 +25,22 @@ func (rt *_router) getBansList(w http.ResponseWriter, r *http.Request, ps httpro
 	user.UserId = header
 	user.Username = ps.ByName("username")
 
-	// Get the bans list
-	bans, err := rt.db.GetBansList(user.UserId)
+	// Validate the requested page
+	cursor, limit, err := parsePage(r.URL.Query())
 	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Return the bans list
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(bans)
+	// Get the bans list
+	bans, nextCursor, err := rt.db.GetBansList(user.UserId, cursor, limit)
 	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		respondWithPageError(w, err)
 		return
 	}
+
+	// Return the bans list
+	respondWithPage(w, bans, nextCursor)
 }
 
 /*
@@ -0,0 +1,386 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+)
+
+/*
+getRequesterCollection Get the collection identified by the `collectionId` path parameter.
+Collections are private, so a collection of another user is reported as not found.
+On failure the error response is already written and false is returned.
+*/
+func (rt *_router) getRequesterCollection(w http.ResponseWriter, ps httprouter.Params, header uint) (Collection, bool) {
+	collectionIdUint64, err := strconv.ParseUint(ps.ByName("collectionId"), 10, 64)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return Collection{}, false
+	}
+
+	collection, err := rt.db.GetCollection(uint(collectionIdUint64), header)
+	if err != nil {
+		var notFound *CollectionNotFoundError
+		if errors.As(err, &notFound) {
+			respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		} else {
+			respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return Collection{}, false
+	}
+
+	return collection, true
+}
+
+/*
+getCollections Get the list of collections of the requester.
+
+	curl -X GET BASE_URL/users/USERNAME/collections -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getCollections(w http.ResponseWriter, r *http.Request, _ httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the collections from the db
+	collections, err := rt.db.GetCollections(header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the collections
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(collections)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+createCollection Create a new empty collection.
+
+	curl -X POST BASE_URL/users/USERNAME/collections -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json' -d '{"name": "NAME"}'
+*/
+func (rt *_router) createCollection(w http.ResponseWriter, r *http.Request, _ httprouter.Params, _ reqcontext.RequestContext) {
+	var collection Collection
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the collection's name from the request body
+	err = json.NewDecoder(r.Body).Decode(&collection)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = validateString(collectionNamePattern, collection.Name); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Create the collection
+	collection.OwnerId = header
+	collection, err = rt.db.CreateCollection(collection)
+	if err != nil {
+		var nameTaken *CollectionNameTakenError
+		if errors.As(err, &nameTaken) {
+			respondWithJSONError(w, err.Error(), http.StatusConflict)
+		} else {
+			respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Return the collection
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(collection)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+renameCollection Change the name of a collection.
+
+	curl -X PUT BASE_URL/users/USERNAME/collections/COLLECTION_ID -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json' -d '{"name": "NAME"}'
+*/
+func (rt *_router) renameCollection(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var newCollection Collection
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the collection's data from the db
+	collection, ok := rt.getRequesterCollection(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Get the new name from the request body
+	err = json.NewDecoder(r.Body).Decode(&newCollection)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = validateString(collectionNamePattern, newCollection.Name); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Rename the collection
+	collection.Name = newCollection.Name
+	collection, err = rt.db.RenameCollection(collection)
+	if err != nil {
+		var nameTaken *CollectionNameTakenError
+		if errors.As(err, &nameTaken) {
+			respondWithJSONError(w, err.Error(), http.StatusConflict)
+		} else {
+			respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Return the collection
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(collection)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+deleteCollection Delete a collection. The photos saved in it are not affected.
+
+	curl -X DELETE BASE_URL/users/USERNAME/collections/COLLECTION_ID -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) deleteCollection(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the collection's data from the db
+	collection, ok := rt.getRequesterCollection(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Delete the collection
+	err = rt.db.DeleteCollection(collection)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+getCollectionPhotos Get the list of photos saved in a collection, in the collection's order.
+
+	curl -X GET BASE_URL/users/USERNAME/collections/COLLECTION_ID/photos -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getCollectionPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the collection's data from the db
+	collection, ok := rt.getRequesterCollection(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Get the photos from the db
+	photos, err := rt.db.GetCollectionPhotos(collection)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the photos
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(photos)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+addToCollection Save a photo at the end of a collection.
+Photos of users that banned the requester cannot be saved.
+
+	curl -X PUT BASE_URL/users/USERNAME/collections/COLLECTION_ID/photos/PHOTO_ID -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) addToCollection(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the collection's data from the db
+	collection, ok := rt.getRequesterCollection(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Get the photo's data from the db
+	photo, ok := rt.getVisiblePhoto(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Check if the requester was banned by the owner of the photo
+	isBanned, err := rt.db.GetBanStatus(photo.OwnerId, header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if isBanned {
+		respondWithJSONError(w, "you were banned by the owner of the photo", http.StatusForbidden)
+		return
+	}
+
+	// Save the photo in the collection
+	err = rt.db.AddToCollection(collection.CollectionId, photo.PhotoId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+removeFromCollection Remove a photo from a collection.
+
+	curl -X DELETE BASE_URL/users/USERNAME/collections/COLLECTION_ID/photos/PHOTO_ID -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) removeFromCollection(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the collection's data from the db
+	collection, ok := rt.getRequesterCollection(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Parse the photo id, the photo may have been deleted already
+	photoIdUint64, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Remove the photo from the collection
+	err = rt.db.RemoveFromCollection(collection.CollectionId, uint(photoIdUint64))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+reorderCollection Move the given photos to the top of a collection, in the given order.
+Photos not in the list keep their relative order after the given ones.
+
+	curl -X PUT BASE_URL/users/USERNAME/collections/COLLECTION_ID/order -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json' -d '{"photoIds": [3, 1, 2]}'
+*/
+func (rt *_router) reorderCollection(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var order struct {
+		PhotoIds []uint `json:"photoIds"`
+	}
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the collection's data from the db
+	collection, ok := rt.getRequesterCollection(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Get the new order from the request body
+	err = json.NewDecoder(r.Body).Decode(&order)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	seen := make(map[uint]bool, len(order.PhotoIds))
+	for _, photoId := range order.PhotoIds {
+		if seen[photoId] {
+			respondWithJSONError(w, "duplicate photo in the new order", http.StatusBadRequest)
+			return
+		}
+		seen[photoId] = true
+	}
+
+	// Reorder the collection
+	err = rt.db.ReorderCollection(collection.CollectionId, order.PhotoIds)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the photos in the new order
+	photos, err := rt.db.GetCollectionPhotos(collection)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(photos)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+)
+
+// maxPinnedComments is the maximum number of comments pinned to the top of the comments of a photo.
+const maxPinnedComments = 3
+
+/*
+getRequesterPhotoComment is a helper function to get the comment in the path, if the requester owns the photo it is
+under. It responds with the error and returns false otherwise.
+*/
+func (rt *_router) getRequesterPhotoComment(w http.ResponseWriter, ps httprouter.Params, header uint) (Photo, Comment, bool) {
+	photo, comment, ok := rt.getRequesterComment(w, ps, header)
+	if !ok {
+		return Photo{}, Comment{}, false
+	}
+	if photo.OwnerId != header {
+		respondWithJSONError(w, "only the owner of the photo can moderate its comments", http.StatusForbidden)
+		return Photo{}, Comment{}, false
+	}
+	return photo, comment, true
+}
+
+/*
+pinComment Pin a comment to the top of the comments of a photo, up to maxPinnedComments per photo.
+Only the owner of the photo can pin its comments, and replies cannot be pinned.
+
+	curl -X PUT BASE_URL/users/USERNAME/photos/PHOTO_ID/comments/COMMENT_ID/pin -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) pinComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the comment's data from the db
+	photo, comment, ok := rt.getRequesterPhotoComment(w, ps, header)
+	if !ok {
+		return
+	}
+	if comment.Deleted {
+		respondWithJSONError(w, (&CommentNotFoundError{CommentId: comment.CommentId}).Error(), http.StatusNotFound)
+		return
+	}
+	if comment.ParentCommentId != nil {
+		respondWithJSONError(w, "replies cannot be pinned", http.StatusBadRequest)
+		return
+	}
+
+	// Pin the comment, unless it is already pinned
+	if comment.PinnedAt == nil {
+		pinned, err := rt.db.PinComment(photo.PhotoId, comment.CommentId, maxPinnedComments)
+		if err != nil {
+			respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !pinned {
+			respondWithJSONError(w, fmt.Sprintf("at most %d comments can be pinned", maxPinnedComments), http.StatusConflict)
+			return
+		}
+	}
+
+	// Return the updated comment
+	comment, err = rt.db.GetComment(photo.PhotoId, comment.CommentId, header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(comment)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+unpinComment Unpin a comment from the top of the comments of a photo.
+Only the owner of the photo can unpin its comments.
+
+	curl -X DELETE BASE_URL/users/USERNAME/photos/PHOTO_ID/comments/COMMENT_ID/pin -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) unpinComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the comment's data from the db
+	photo, comment, ok := rt.getRequesterPhotoComment(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Unpin the comment
+	err = rt.db.UnpinComment(photo.PhotoId, comment.CommentId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+setCommentsLocked is a helper function to turn off, or back on, new comments on the photo in the path.
+Only the owner of the photo can do it.
+*/
+func (rt *_router) setCommentsLocked(w http.ResponseWriter, r *http.Request, ps httprouter.Params, locked bool) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the photo's data from the db
+	photoIdUint64, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	photo, err := rt.db.GetPhoto(uint(photoIdUint64))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if photo.OwnerId != header {
+		respondWithJSONError(w, "only the owner of the photo can turn its comments on or off", http.StatusForbidden)
+		return
+	}
+
+	// Update the photo
+	err = rt.db.SetCommentsLocked(photo.PhotoId, locked)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	photo.CommentsLocked = locked
+
+	// Return the updated photo
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(photo)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+lockComments Turn off new comments and replies on a photo, the existing ones are kept.
+
+	curl -X PUT BASE_URL/users/USERNAME/photos/PHOTO_ID/lock -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) lockComments(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	rt.setCommentsLocked(w, r, ps, true)
+}
+
+/*
+unlockComments Turn new comments and replies on a photo back on.
+
+	curl -X DELETE BASE_URL/users/USERNAME/photos/PHOTO_ID/lock -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) unlockComments(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	rt.setCommentsLocked(w, r, ps, false)
+}
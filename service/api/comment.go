@@ -2,50 +2,121 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
 	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"net/url"
 	"strconv"
 )
 
+// defaultCommentDepth is the number of levels of replies returned with the comments when no depth is given.
+const defaultCommentDepth = 3
+
+// maxCommentDepth is the maximum number of levels of replies returned with the comments.
+const maxCommentDepth = 10
+
+// parseCommentDepth is a helper function to parse the optional `depth` query parameter of the comments.
+func parseCommentDepth(query url.Values) (int, error) {
+	if query.Get("depth") == "" {
+		return defaultCommentDepth, nil
+	}
+	depth, err := strconv.Atoi(query.Get("depth"))
+	if err != nil || depth < 0 || depth > maxCommentDepth {
+		return 0, fmt.Errorf("depth must be an integer between 0 and %d", maxCommentDepth)
+	}
+	return depth, nil
+}
+
 /*
-getPhotoComments Get all comments under a photo.
+nestComments is a helper function to arrange a flat list of comments in threads.
+It returns the replies to the given parent, 0 for the top level comments, each one with its replies up to depth levels
+below. Every comment has its ReplyCount set, even when its replies are beyond the depth.
+Comments whose parent is missing are considered top level comments.
+*/
+func nestComments(comments []Comment, parentCommentId uint, depth int) []Comment {
+	exists := make(map[uint]bool, len(comments))
+	for _, comment := range comments {
+		exists[comment.CommentId] = true
+	}
+
+	children := make(map[uint][]Comment)
+	for _, comment := range comments {
+		parent := uint(0)
+		if comment.ParentCommentId != nil && exists[*comment.ParentCommentId] {
+			parent = *comment.ParentCommentId
+		}
+		children[parent] = append(children[parent], comment)
+	}
 
-	curl -X GET BASE_URL/users/USERNAME/photos/PHOTO_ID/comments -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json'
+	var build func(parent uint, level int) []Comment
+	build = func(parent uint, level int) []Comment {
+		replies := make([]Comment, 0, len(children[parent]))
+		for _, comment := range children[parent] {
+			comment.ReplyCount = uint(len(children[comment.CommentId]))
+			if level < depth && comment.ReplyCount > 0 {
+				comment.Replies = build(comment.CommentId, level+1)
+			}
+			replies = append(replies, comment)
+		}
+		return replies
+	}
+	return build(parentCommentId, 0)
+}
+
+/*
+getPhotoComments Get a page of the comments under a photo, with their replies nested up to the given depth.
+
+	curl -X GET 'BASE_URL/users/USERNAME/photos/PHOTO_ID/comments?depth=DEPTH&cursor=CURSOR&limit=LIMIT' -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json'
 */
 func (rt *_router) getPhotoComments(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
-	var photo Photo
 
 	// Get the requesters data from the auth header
-	_, err := parseAuthHeader(r.Header.Get("Authorization"))
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
 	if err != nil {
 		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// Get the photo's data from the db
-	photoIdUint64, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
+	photo, ok := rt.getVisiblePhoto(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Validate the depth of the replies
+	depth, err := parseCommentDepth(r.URL.Query())
 	if err != nil {
 		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	photo.PhotoId = uint(photoIdUint64)
 
-	// Get the comments from the db
-	comments, err := rt.db.GetPhotoComments(photo.PhotoId)
+	// Validate the requested page
+	cursor, limit, err := parsePage(r.URL.Query())
 	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Return the comments
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(comments)
+	// Get the comments from the db, with one more level of replies to count the replies of the last nested ones
+	comments, nextCursor, err := rt.db.GetPhotoComments(photo.PhotoId, header, cursor, limit, depth+1)
+	if err != nil {
+		respondWithPageError(w, err)
+		return
+	}
+
+	// Hide the comments containing the hidden words of the owner of the photo
+	comments, err = rt.hideComments(photo, header, comments)
 	if err != nil {
 		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	comments = nestComments(comments, 0, depth)
+
+	// Return the comments
+	respondWithPage(w, comments, nextCursor)
 }
 
 /*
@@ -54,7 +125,20 @@ commentPhoto Add a comment under a photo.
 	curl -X POST BASE_URL/users/USERNAME/photos/PHOTO_ID/comments -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json' -d '{"content": "CONTENT"}'
 */
 func (rt *_router) commentPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
-	var photo Photo
+	rt.postComment(w, r, ps, false)
+}
+
+/*
+replyToComment Add a reply to a comment under a photo.
+
+	curl -X POST BASE_URL/users/USERNAME/photos/PHOTO_ID/comments/COMMENT_ID/replies -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json' -d '{"content": "CONTENT"}'
+*/
+func (rt *_router) replyToComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	rt.postComment(w, r, ps, true)
+}
+
+// postComment is a helper function to add a comment under a photo, or a reply to the comment in the path if isReply.
+func (rt *_router) postComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, isReply bool) {
 	var user User
 	var comment Comment
 
@@ -82,12 +166,14 @@ func (rt *_router) commentPhoto(w http.ResponseWriter, r *http.Request, ps httpr
 	comment.OwnerUsername = user.Username
 
 	// Get the photo's data from the db
-	photoIdUint64, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
-	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+	photo, ok := rt.getVisiblePhoto(w, ps, header)
+	if !ok {
+		return
+	}
+	if photo.CommentsLocked {
+		respondWithJSONError(w, "comments are turned off for this photo", http.StatusForbidden)
 		return
 	}
-	photo.PhotoId = uint(photoIdUint64)
 
 	// Get the comment's data from the request body
 	err = json.NewDecoder(r.Body).Decode(&comment)
@@ -102,6 +188,31 @@ func (rt *_router) commentPhoto(w http.ResponseWriter, r *http.Request, ps httpr
 		return
 	}
 
+	// Get the comment being replied to, which must be under the same photo and not deleted
+	comment.ParentCommentId = nil
+	if isReply {
+		commentIdUint64, err := strconv.ParseUint(ps.ByName("commentId"), 10, 64)
+		if err != nil {
+			respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		parent, err := rt.db.GetComment(photo.PhotoId, uint(commentIdUint64), header)
+		if err != nil {
+			var notFound *CommentNotFoundError
+			if errors.As(err, &notFound) {
+				respondWithJSONError(w, err.Error(), http.StatusNotFound)
+			} else {
+				respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		if parent.Deleted {
+			respondWithJSONError(w, "cannot reply to a deleted comment", http.StatusBadRequest)
+			return
+		}
+		comment.ParentCommentId = &parent.CommentId
+	}
+
 	// Comment the photo
 	comment, err = rt.db.CommentPhoto(photo.PhotoId, comment)
 	if err != nil {
@@ -109,6 +220,21 @@ func (rt *_router) commentPhoto(w http.ResponseWriter, r *http.Request, ps httpr
 		return
 	}
 
+	// Store the users mentioned in the comment
+	err = rt.db.AddMentions(photo.PhotoId, comment.CommentId, comment.OwnerId, parseMentions(comment.Content))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Tell the author if the comment is hidden by the hidden words of the owner of the photo
+	words, err := rt.db.GetHiddenWords(photo.OwnerId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	comment.Hidden = isHiddenComment(compileHiddenWords(words), photo, comment)
+
 	// Return the created comment
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -121,11 +247,11 @@ func (rt *_router) commentPhoto(w http.ResponseWriter, r *http.Request, ps httpr
 
 /*
 uncommentPhoto Remove a comment from a photo.
+The owner of the photo can remove any comment under it, the other users only their own.
 
 	curl -X DELETE BASE_URL/users/USERNAME/photos/PHOTO_ID/comments/COMMENT_ID -H 'Authorization: Bearer USER_ID'
 */
 func (rt *_router) uncommentPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
-	var photo Photo
 	var comment Comment
 
 	// Get the requesters data from the auth header
@@ -137,12 +263,10 @@ func (rt *_router) uncommentPhoto(w http.ResponseWriter, r *http.Request, ps htt
 	comment.OwnerId = header
 
 	// Get the photo's data from the db
-	photoIdUint64, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
-	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+	photo, ok := rt.getVisiblePhoto(w, ps, header)
+	if !ok {
 		return
 	}
-	photo.PhotoId = uint(photoIdUint64)
 
 	// Get the comment's data from the db
 	commentIdUint64, err := strconv.ParseUint(ps.ByName("commentId"), 10, 64)
@@ -153,7 +277,11 @@ func (rt *_router) uncommentPhoto(w http.ResponseWriter, r *http.Request, ps htt
 	comment.CommentId = uint(commentIdUint64)
 
 	// Uncomment the photo
-	err = rt.db.UncommentPhoto(photo.PhotoId, comment)
+	if photo.OwnerId == header {
+		err = rt.db.DeleteComment(photo.PhotoId, comment.CommentId)
+	} else {
+		err = rt.db.UncommentPhoto(photo.PhotoId, comment)
+	}
 	if err != nil {
 		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -163,3 +291,200 @@ func (rt *_router) uncommentPhoto(w http.ResponseWriter, r *http.Request, ps htt
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusNoContent)
 }
+
+/*
+getRequesterComment is a helper function to get the comment in the path as seen by the requester, along with the photo
+it is under.
+If the photo or the comment do not exist, it responds with the error and returns false.
+*/
+func (rt *_router) getRequesterComment(w http.ResponseWriter, ps httprouter.Params, header uint) (Photo, Comment, bool) {
+	// Get the photo's data from the db
+	photo, ok := rt.getVisiblePhoto(w, ps, header)
+	if !ok {
+		return Photo{}, Comment{}, false
+	}
+
+	// Get the comment's data from the db
+	commentIdUint64, err := strconv.ParseUint(ps.ByName("commentId"), 10, 64)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return Photo{}, Comment{}, false
+	}
+	comment, err := rt.db.GetComment(photo.PhotoId, uint(commentIdUint64), header)
+	if err != nil {
+		var notFound *CommentNotFoundError
+		if errors.As(err, &notFound) {
+			respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		} else {
+			respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return Photo{}, Comment{}, false
+	}
+
+	return photo, comment, true
+}
+
+/*
+getCommentReplies Get the replies to a comment, nested up to the given depth.
+
+	curl -X GET 'BASE_URL/users/USERNAME/photos/PHOTO_ID/comments/COMMENT_ID/replies?depth=DEPTH' -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getCommentReplies(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the depth of the replies
+	depth, err := parseCommentDepth(r.URL.Query())
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check that the comment exists
+	photo, comment, ok := rt.getRequesterComment(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Get the replies from the db, along with the comment they are nested under.
+	// The direct replies are nested depth levels deep, plus one level to count the replies of the last nested ones.
+	replies, err := rt.db.GetCommentReplies(comment.CommentId, header, depth+2)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	comments := append([]Comment{comment}, replies...)
+	comments, err = rt.hideComments(photo, header, comments)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	replies = nestComments(comments, comment.CommentId, depth)
+
+	// Return the replies
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(replies)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+editComment Replace the content of a comment under a photo, the previous one is kept in its history.
+Only the owner of the comment can edit it.
+
+	curl -X PATCH BASE_URL/users/USERNAME/photos/PHOTO_ID/comments/COMMENT_ID -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json' -d '{"content": "CONTENT"}'
+*/
+func (rt *_router) editComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var body struct {
+		Content string `json:"content"`
+	}
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the comment's data from the db
+	photo, comment, ok := rt.getRequesterComment(w, ps, header)
+	if !ok {
+		return
+	}
+	if comment.Deleted {
+		respondWithJSONError(w, (&CommentNotFoundError{CommentId: comment.CommentId}).Error(), http.StatusNotFound)
+		return
+	}
+	if comment.OwnerId != header {
+		respondWithJSONError(w, "only the owner of the comment can edit it", http.StatusForbidden)
+		return
+	}
+
+	// Get the new content from the request body
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = validateString(commentPattern, body.Content); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Edit the comment, along with the users mentioned in the new content
+	err = rt.db.EditComment(photo.PhotoId, comment.CommentId, body.Content, parseMentions(body.Content))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	edited, err := rt.db.GetComment(photo.PhotoId, comment.CommentId, header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Tell the author if the comment is hidden by the hidden words of the owner of the photo
+	words, err := rt.db.GetHiddenWords(photo.OwnerId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	edited.Hidden = isHiddenComment(compileHiddenWords(words), photo, edited)
+
+	// Return the edited comment
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(edited)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+getCommentHistory Get the previous versions of an edited comment, from oldest to newest.
+Only the owner of the photo can see them.
+
+	curl -X GET BASE_URL/users/USERNAME/photos/PHOTO_ID/comments/COMMENT_ID/history -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getCommentHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the comment's data from the db
+	photo, comment, ok := rt.getRequesterComment(w, ps, header)
+	if !ok {
+		return
+	}
+	if photo.OwnerId != header {
+		respondWithJSONError(w, "only the owner of the photo can see the history of its comments", http.StatusForbidden)
+		return
+	}
+
+	// Get the previous versions from the db
+	versions, err := rt.db.GetCommentVersions(comment.CommentId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the previous versions
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(versions)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
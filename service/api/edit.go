@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/imaging"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+)
+
+/*
+editPhoto Apply a list of edit operations to a photo, publishing the edited version as a new photo.
+The original photo is left untouched, with its likes and comments. Only the owner of the photo can edit it.
+The new version keeps the caption, alt text, location and sensitive mark of the original.
+
+	curl -X POST BASE_URL/users/USERNAME/photos/PHOTO_ID/edits -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json' -d '{"operations": [{"type": "rotate", "angle": 90}, {"type": "grayscale"}]}'
+*/
+func (rt *_router) editPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var edit struct {
+		Operations []imaging.Operation `json:"operations"`
+	}
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the photo's data from the db
+	photoIdUint64, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	photo, err := rt.db.GetPhoto(uint(photoIdUint64))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if photo.OwnerId != header {
+		respondWithJSONError(w, "only the owner of the photo can edit it", http.StatusForbidden)
+		return
+	}
+
+	// Get the operations from the request body
+	err = json.NewDecoder(r.Body).Decode(&edit)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(edit.Operations) == 0 {
+		respondWithJSONError(w, "at least one operation is required", http.StatusBadRequest)
+		return
+	}
+
+	// Apply the operations to a copy of the photo
+	version := Photo{
+		OwnerId:         photo.OwnerId,
+		Caption:         photo.Caption,
+		AltText:         photo.AltText,
+		Latitude:        photo.Latitude,
+		Longitude:       photo.Longitude,
+		PlaceName:       photo.PlaceName,
+		Sensitive:       photo.Sensitive,
+		SensitiveReason: photo.SensitiveReason,
+		SensitiveBy:     photo.SensitiveBy,
+	}
+	version.Image, version.MimeType, err = imaging.Edit(photo.Image, edit.Operations)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	version, err = rt.transcodePhoto(version)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Store the new version of the photo, if it fits in the quota of the owner
+	version, err = rt.createPhoto(version)
+	if err != nil {
+		respondWithUploadError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Return the new version of the photo
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(version)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -2,16 +2,37 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
 	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"net/url"
+	"strconv"
 )
 
+// defaultSuggestions is the number of users suggested to follow when no limit is given.
+const defaultSuggestions = 10
+
+// maxSuggestions is the maximum number of users suggested to follow.
+const maxSuggestions = 50
+
+// parseSuggestionsLimit is a helper function to get the number of users to suggest from the `limit` query parameter.
+func parseSuggestionsLimit(query url.Values) (int, error) {
+	if query.Get("limit") == "" {
+		return defaultSuggestions, nil
+	}
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit < 1 || limit > maxSuggestions {
+		return 0, fmt.Errorf("limit must be an integer between 1 and %d", maxSuggestions)
+	}
+	return limit, nil
+}
+
 /*
 getFollowersList Get the list of followers for a user via username.
 
-	curl -X GET BASE_URL/users/USERNAME/followers/list -H 'Authorization: Bearer USER_ID'
+	curl -X GET 'BASE_URL/users/USERNAME/followers/list?cursor=CURSOR&limit=LIMIT' -H 'Authorization: Bearer USER_ID'
 */
 func (rt *_router) getFollowersList(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
 	var user User
@@ -31,27 +52,28 @@ func (rt *_router) getFollowersList(w http.ResponseWriter, r *http.Request, ps h
 		return
 	}
 
-	// Get the followers list
-	followers, err := rt.db.GetFollowersList(user.UserId)
+	// Validate the requested page
+	cursor, limit, err := parsePage(r.URL.Query())
 	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Return the followers list
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(followers)
+	// Get the followers list
+	followers, nextCursor, err := rt.db.GetFollowersList(user.UserId, cursor, limit)
 	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		respondWithPageError(w, err)
 		return
 	}
+
+	// Return the followers list
+	respondWithPage(w, followers, nextCursor)
 }
 
 /*
 getFollowingList Get the list of users a user is following via username.
 
-	curl -X GET BASE_URL/users/USERNAME/following/list -H 'Authorization : Bearer USER_ID'
+	curl -X GET 'BASE_URL/users/USERNAME/following/list?cursor=CURSOR&limit=LIMIT' -H 'Authorization : Bearer USER_ID'
 */
 func (rt *_router) getFollowingList(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
 	var user User
@@ -71,21 +93,22 @@ func (rt *_router) getFollowingList(w http.ResponseWriter, r *http.Request, ps h
 		return
 	}
 
-	// Get the following list
-	following, err := rt.db.GetFollowingList(user.UserId)
+	// Validate the requested page
+	cursor, limit, err := parsePage(r.URL.Query())
 	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Return the following list
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(following)
+	// Get the following list
+	following, nextCursor, err := rt.db.GetFollowingList(user.UserId, cursor, limit)
 	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		respondWithPageError(w, err)
 		return
 	}
+
+	// Return the following list
+	respondWithPage(w, following, nextCursor)
 }
 
 /*
@@ -259,3 +282,47 @@ func (rt *_router) unfollowUser(w http.ResponseWriter, r *http.Request, ps httpr
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusNoContent)
 }
+
+/*
+getSuggestions Get the users suggested to the requester to follow, the friends of their friends first.
+They are ranked by mutual followers, then by shared likes, then by recent activity.
+
+	curl -X GET 'BASE_URL/users/USERNAME/suggestions?limit=LIMIT' -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getSuggestions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the user's data from the db, only the user can get their suggestions
+	user, ok := rt.getRequesterSettingsUser(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Validate the limit
+	limit, err := parseSuggestionsLimit(r.URL.Query())
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the suggestions from the db
+	suggestions, err := rt.db.GetSuggestions(user.UserId, limit)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the suggestions
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(suggestions)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -14,12 +15,42 @@ import (
 // usernamePattern is the regex pattern for a valid username.
 const usernamePattern = `^[A-Za-z0-9_\-]{3,32}$`
 
+// userSearchPattern is the regex pattern for a valid text to search in the usernames.
+const userSearchPattern = `^[A-Za-z0-9_\-]{1,32}$`
+
 // captionPattern is the regex pattern for a valid post caption.
 const captionPattern = `^[\p{L}\p{N}\p{M}\p{P}\p{S} ]{0,32}$`
 
+// altTextPattern is the regex pattern for a valid description of a photo for the users of screen readers.
+const altTextPattern = `^[\p{L}\p{N}\p{M}\p{P}\p{S} \n]{0,1000}$`
+
+// sensitiveReasonPattern is the regex pattern for a valid content warning of a sensitive photo.
+const sensitiveReasonPattern = `^[\p{L}\p{N}\p{M}\p{P}\p{S} ]{0,64}$`
+
 // commentPattern is the regex pattern for a valid post comment.
 const commentPattern = `^[\p{L}\p{N}\p{M}\p{P}\p{S} \n]{1,256}$`
 
+// placeNamePattern is the regex pattern for a valid name of the place where a photo was taken.
+const placeNamePattern = `^[\p{L}\p{N}\p{M}\p{P}\p{S} ]{0,64}$`
+
+// collectionNamePattern is the regex pattern for a valid name of a collection of saved photos.
+const collectionNamePattern = `^[\p{L}\p{N}\p{M}\p{P}\p{S} ]{1,32}$`
+
+// reactionPattern is the regex pattern for a valid reaction, a single emoji.
+const reactionPattern = `^[\p{S}\p{M}\p{Cf}]{1,16}$`
+
+// mentionPattern is the regex pattern for a `@username` mention inside a caption or a comment.
+const mentionPattern = `(?:^|[^\w@])@([A-Za-z0-9_\-]{3,32})`
+
+// mentionRegexp is the compiled version of mentionPattern.
+var mentionRegexp = regexp.MustCompile(mentionPattern)
+
+// defaultPageSize is the number of items in a page of a list when no limit is given.
+const defaultPageSize = 50
+
+// maxPageSize is the maximum number of items in a page of a list.
+const maxPageSize = 100
+
 // parseAuthHeader is a helper function to parse the authorization header and return the user id.
 func parseAuthHeader(header string) (uint, error) {
 	// Remove the "Bearer " prefix
@@ -70,3 +101,51 @@ func respondWithJSONError(w http.ResponseWriter, message string, statusCode int)
 		http.Error(w, fmt.Sprintf("Error encoding error message: %v", err), http.StatusInternalServerError)
 	}
 }
+
+/*
+parsePage is a helper function to get the page of a list requested via the `cursor` and `limit` query parameters.
+The cursor is opaque, it is the `nextCursor` of the previous page, or empty for the first page.
+*/
+func parsePage(query url.Values) (string, int, error) {
+	limit := defaultPageSize
+	if query.Get("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return "", 0, fmt.Errorf("limit must be an integer between 1 and %d", maxPageSize)
+		}
+	}
+	return query.Get("cursor"), limit, nil
+}
+
+// respondWithPage is a helper function to respond to a request with a page of a list.
+func respondWithPage(w http.ResponseWriter, items interface{}, nextCursor string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(Page{Items: items, NextCursor: nextCursor}); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// respondWithPageError is a helper function to respond to a request for a page of a list that failed with the given error.
+func respondWithPageError(w http.ResponseWriter, err error) {
+	var cursorErr *InvalidCursorError
+	if errors.As(err, &cursorErr) {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+}
+
+// parseMentions is a helper function to extract the usernames mentioned in a text, without duplicates.
+func parseMentions(text string) []string {
+	usernames := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, match := range mentionRegexp.FindAllStringSubmatch(text, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			usernames = append(usernames, match[1])
+		}
+	}
+	return usernames
+}
@@ -0,0 +1,271 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// maxHiddenWords is the maximum number of words and phrases a user can hide from the comments on their photos.
+const maxHiddenWords = 100
+
+// hiddenWordPattern is the regex pattern for a valid hidden word or phrase, where `*` matches any part of a word.
+const hiddenWordPattern = `^[\p{L}\p{N}\p{M}\p{P}\p{S} ]{1,64}$`
+
+// wordCharacters are the characters words are made of, as the content of a regex class, to match whole words only.
+const wordCharacters = `\p{L}\p{N}\p{M}_`
+
+// whitespace matches the whitespace between the words of a phrase.
+var whitespace = regexp.MustCompile(`\s+`)
+
+/*
+compileHiddenWords is a helper function to build the regex matching any of the given words and phrases, ignoring
+case. Only whole words are matched, so `bad` does not match `badge`, unless a `*` stands for the rest of the word,
+as in `bad*`. The words of a phrase can be separated by any whitespace. It returns nil if there are no words.
+*/
+func compileHiddenWords(words []string) *regexp.Regexp {
+	if len(words) == 0 {
+		return nil
+	}
+
+	alternatives := make([]string, 0, len(words))
+	for _, word := range words {
+		parts := strings.Split(word, "*")
+		for i, part := range parts {
+			parts[i] = whitespace.ReplaceAllLiteralString(regexp.QuoteMeta(part), `\s+`)
+		}
+		alternatives = append(alternatives, strings.Join(parts, `[`+wordCharacters+`]*`))
+	}
+	return regexp.MustCompile(`(?i)(?:^|[^` + wordCharacters + `])(?:` + strings.Join(alternatives, "|") + `)(?:$|[^` + wordCharacters + `])`)
+}
+
+// isHiddenComment is a helper function to check if a comment on a photo must be hidden by the hidden words.
+func isHiddenComment(hiddenWords *regexp.Regexp, photo Photo, comment Comment) bool {
+	return hiddenWords != nil && !comment.Deleted && !comment.Approved && comment.OwnerId != photo.OwnerId &&
+		hiddenWords.MatchString(comment.Content)
+}
+
+/*
+hideComments is a helper function to apply the hidden words of the owner of a photo to its comments, as seen by a
+viewer. The comments containing them, and not approved by the owner, are only returned to their author, marked as
+hidden. Their replies are kept.
+*/
+func (rt *_router) hideComments(photo Photo, viewerId uint, comments []Comment) ([]Comment, error) {
+	words, err := rt.db.GetHiddenWords(photo.OwnerId)
+	if err != nil {
+		return nil, err
+	}
+	hiddenWords := compileHiddenWords(words)
+
+	visible := make([]Comment, 0, len(comments))
+	for _, comment := range comments {
+		if isHiddenComment(hiddenWords, photo, comment) {
+			if comment.OwnerId != viewerId {
+				continue
+			}
+			comment.Hidden = true
+		}
+		visible = append(visible, comment)
+	}
+	return visible, nil
+}
+
+/*
+getHiddenWords Get the words and phrases the requester hides from the comments on their photos.
+
+	curl -X GET BASE_URL/users/USERNAME/hidden-words -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getHiddenWords(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the user's data from the db
+	user, ok := rt.getRequesterSettingsUser(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Get the hidden words from the db
+	words, err := rt.db.GetHiddenWords(user.UserId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the hidden words
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(words)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+setHiddenWords Replace the words and phrases the requester hides from the comments on their photos.
+They apply to the existing comments too, except for the approved ones.
+
+	curl -X PUT BASE_URL/users/USERNAME/hidden-words -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json' -d '["WORD", "PREFIX*", "SOME PHRASE"]'
+*/
+func (rt *_router) setHiddenWords(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var words []string
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the user's data from the db
+	user, ok := rt.getRequesterSettingsUser(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Get the hidden words from the request body
+	err = json.NewDecoder(r.Body).Decode(&words)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(words) > maxHiddenWords {
+		respondWithJSONError(w, fmt.Sprintf("at most %d hidden words are allowed", maxHiddenWords), http.StatusBadRequest)
+		return
+	}
+	for i, word := range words {
+		words[i] = strings.ToLower(strings.Join(strings.Fields(word), " "))
+		if err = validateString(hiddenWordPattern, words[i]); err != nil {
+			respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if strings.Trim(words[i], "* ") == "" {
+			respondWithJSONError(w, "hidden words must contain more than wildcards", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Store the hidden words
+	err = rt.db.SetHiddenWords(user.UserId, words)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the stored hidden words
+	words, err = rt.db.GetHiddenWords(user.UserId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(words)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+getHiddenComments Get the review queue of the requester, the comments on their photos hidden by their hidden words,
+from oldest to newest. Each one can be approved with approveComment, or deleted with uncommentPhoto.
+
+	curl -X GET 'BASE_URL/users/USERNAME/hidden-comments?cursor=CURSOR&limit=LIMIT' -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getHiddenComments(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the user's data from the db
+	user, ok := rt.getRequesterSettingsUser(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Get a page of the comments that are not approved and match the hidden words
+	cursor, limit, err := parsePage(r.URL.Query())
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	words, err := rt.db.GetHiddenWords(user.UserId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	hiddenWords := compileHiddenWords(words)
+	if hiddenWords == nil {
+		respondWithPage(w, make([]Comment, 0), "")
+		return
+	}
+	comments, nextCursor, err := rt.db.GetUnapprovedComments(user.UserId, cursor, limit, func(comment Comment) bool {
+		return isHiddenComment(hiddenWords, Photo{OwnerId: user.UserId}, comment)
+	})
+	if err != nil {
+		respondWithPageError(w, err)
+		return
+	}
+	for i := range comments {
+		comments[i].Hidden = true
+	}
+
+	// Return the page of hidden comments
+	respondWithPage(w, comments, nextCursor)
+}
+
+/*
+approveComment Approve a comment on a photo of the requester, showing it to everyone even if it contains their hidden
+words. The approval is revoked if the comment is edited.
+
+	curl -X PUT BASE_URL/users/USERNAME/photos/PHOTO_ID/comments/COMMENT_ID/approval -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) approveComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the comment's data from the db
+	photo, comment, ok := rt.getRequesterPhotoComment(w, ps, header)
+	if !ok {
+		return
+	}
+	if comment.Deleted {
+		respondWithJSONError(w, (&CommentNotFoundError{CommentId: comment.CommentId}).Error(), http.StatusNotFound)
+		return
+	}
+
+	// Approve the comment
+	err = rt.db.ApproveComment(photo.PhotoId, comment.CommentId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	comment.Approved = true
+
+	// Return the approved comment
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(comment)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
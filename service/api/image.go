@@ -0,0 +1,166 @@
+package api
+
+import (
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/imaging"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// storeOriginal is the storage format that keeps uploaded photos in the format they were uploaded in.
+const storeOriginal = "original"
+
+/*
+transcodePhoto is a helper function to convert the image of a photo to the configured storage format.
+Photos whose format cannot be decoded, like WebP or AVIF ones, and animated photos are kept as they are.
+It also records whether the photo is animated, so that it is not checked again whenever the photo is served.
+*/
+func (rt *_router) transcodePhoto(photo Photo) (Photo, error) {
+	photo.Animated = imaging.IsAnimated(photo.Image)
+	if rt.storage == storeOriginal || photo.MimeType == rt.storage {
+		return photo, nil
+	}
+	if !imaging.CanDecode(photo.MimeType) || photo.Animated {
+		return photo, nil
+	}
+
+	image, err := imaging.Transcode(photo.Image, rt.storage)
+	if err != nil {
+		return Photo{}, err
+	}
+	photo.Image = image
+	photo.MimeType = rt.storage
+	return photo, nil
+}
+
+/*
+acceptQuality returns the quality the `Accept` header gives to a MIME type, from 0 (not acceptable) to 1.
+The most specific range matching the type is used, so `image/png` wins over `image/*`, which wins over the full wildcard.
+An empty header accepts everything.
+*/
+func acceptQuality(accept string, mimeType string) float64 {
+	if strings.TrimSpace(accept) == "" {
+		return 1
+	}
+
+	quality, specificity := 0.0, -1
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+
+		// Rank the range by how specific it is, skipping the ones not matching
+		var rank int
+		switch {
+		case name == mimeType:
+			rank = 2
+		case name == "*/*":
+			rank = 0
+		case strings.HasSuffix(name, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(name, "*")):
+			rank = 1
+		default:
+			continue
+		}
+		if rank < specificity {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.TrimSpace(key) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			q = parsed
+		}
+		quality, specificity = q, rank
+	}
+	return quality
+}
+
+/*
+negotiateFormat is a helper function to choose the format a photo is served in, given the `Accept` header.
+The stored format is preferred when acceptable, otherwise the photo is transcoded to the best acceptable format it can
+be converted to. It returns false if no acceptable format is available.
+*/
+func negotiateFormat(accept string, photo Photo) (string, bool) {
+	candidates := []string{photo.MimeType}
+	if imaging.CanDecode(photo.MimeType) && !photo.Animated {
+		for _, mimeType := range []string{imaging.JPEG, imaging.PNG} {
+			if mimeType != photo.MimeType {
+				candidates = append(candidates, mimeType)
+			}
+		}
+	}
+
+	best, bestQuality := "", 0.0
+	for _, mimeType := range candidates {
+		if q := acceptQuality(accept, mimeType); q > bestQuality {
+			best, bestQuality = mimeType, q
+		}
+	}
+	return best, best != ""
+}
+
+/*
+getPhotoImage Get the image of a photo, in the best format accepted by the client.
+The image is served as stored when its format is acceptable, otherwise it is transcoded on the fly.
+
+	curl -X GET BASE_URL/users/USERNAME/photos/PHOTO_ID/image -H 'Authorization: Bearer USER_ID' -H 'Accept: image/webp,image/png;q=0.9'
+*/
+func (rt *_router) getPhotoImage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the photo's data from the db
+	photo, ok := rt.getVisiblePhoto(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Check if the requester was banned by the owner of the photo
+	isBanned, err := rt.db.GetBanStatus(photo.OwnerId, header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if isBanned {
+		respondWithJSONError(w, "you were banned by the owner of the photo", http.StatusForbidden)
+		return
+	}
+
+	// Choose the format to serve the image in
+	w.Header().Set("Vary", "Accept")
+	mimeType, ok := negotiateFormat(r.Header.Get("Accept"), photo)
+	if !ok {
+		respondWithJSONError(w, "the image is not available in any of the accepted formats, it is stored as "+photo.MimeType, http.StatusNotAcceptable)
+		return
+	}
+	image := photo.Image
+	if mimeType != photo.MimeType {
+		image, err = imaging.Transcode(photo.Image, mimeType)
+		if err != nil {
+			respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Count the view of the photo, it is written to the db later
+	rt.recordViews(header, ViewOpen, []Photo{photo})
+
+	// Return the image
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(image)
+}
@@ -6,17 +6,16 @@ import (
 	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
-	"strconv"
 )
 
 /*
-likePhoto Add a like to a photo.
+likePhoto Add a like to a photo, that is the first of the available reactions.
+It is kept for compatibility, reactToPhoto sets any reaction.
 
 	curl -X POST BASE_URL/users/USERNAME/photos/PHOTO_ID/likes -H 'Authorization: Bearer USER_ID'
 */
 func (rt *_router) likePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
 	var liker User
-	var photo Photo
 
 	// Get the requesters data from the auth header
 	header, err := parseAuthHeader(r.Header.Get("Authorization"))
@@ -34,24 +33,22 @@ func (rt *_router) likePhoto(w http.ResponseWriter, r *http.Request, ps httprout
 	}
 
 	// Get the photo's data from the db
-	photoIdUint64, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
-	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+	photo, ok := rt.getVisiblePhoto(w, ps, header)
+	if !ok {
 		return
 	}
-	photo, err = rt.db.GetPhoto(uint(photoIdUint64))
+
+	// Like the photo
+	err = rt.db.ReactToPhoto(liker.UserId, photo.PhotoId, rt.reactions[0])
 	if err != nil {
 		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	// Like the photo
-	err = rt.db.LikePhoto(liker.UserId, photo.PhotoId)
+	photo, err = rt.db.GetPhoto(photo.PhotoId)
 	if err != nil {
 		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	photo.LikeCount++
 
 	// Return the photo info
 	w.Header().Set("Content-Type", "application/json")
@@ -64,13 +61,12 @@ func (rt *_router) likePhoto(w http.ResponseWriter, r *http.Request, ps httprout
 }
 
 /*
-unlikePhoto Remove a like from a photo.
+unlikePhoto Remove a like, or any other reaction, from a photo.
 
 	curl -X DELETE BASE_URL/users/USERNAME/photos/PHOTO_ID/likes/LIKER_ID -H 'Authorization: Bearer USER_ID'
 */
 func (rt *_router) unlikePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
 	var unliker User
-	var photo Photo
 
 	// Get the requesters data from the auth header
 	header, err := parseAuthHeader(r.Header.Get("Authorization"))
@@ -81,12 +77,10 @@ func (rt *_router) unlikePhoto(w http.ResponseWriter, r *http.Request, ps httpro
 	unliker.UserId = header
 
 	// Get the photo's data from the db
-	photoIdUint64, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
-	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+	photo, ok := rt.getVisiblePhoto(w, ps, header)
+	if !ok {
 		return
 	}
-	photo.PhotoId = uint(photoIdUint64)
 
 	// Unlike the photo
 	err = rt.db.UnlikePhoto(unliker.UserId, photo.PhotoId)
@@ -107,7 +101,6 @@ getLikeStatus Get the like status of a user for a photo.
 */
 func (rt *_router) getLikeStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
 	var user User
-	var photo Photo
 	var targetUser User
 
 	// Get the requesters data from the auth header
@@ -132,13 +125,11 @@ func (rt *_router) getLikeStatus(w http.ResponseWriter, r *http.Request, ps http
 		return
 	}
 
-	// Get the photo's ID from the path
-	photoIdUint64, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
-	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+	// Get the photo's data from the db
+	photo, ok := rt.getVisiblePhoto(w, ps, header)
+	if !ok {
 		return
 	}
-	photo.PhotoId = uint(photoIdUint64)
 
 	// Check if the target user has liked the photo
 	hasLiked, err := rt.db.GetLikeStatus(targetUser.UserId, photo.PhotoId)
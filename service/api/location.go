@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/geo"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// maxSearchResults is the maximum number of photos returned by a location search.
+const maxSearchResults = 100
+
+// maxSearchRadius is the maximum radius, in meters, of a nearby photos search.
+const maxSearchRadius = 100000
+
+// defaultSearchRadius is the radius, in meters, of a nearby photos search when none is given.
+const defaultSearchRadius = 1000
+
+// parseCoordinate is a helper function to parse a coordinate, in decimal degrees, from the given query parameter.
+func parseCoordinate(query url.Values, name string) (float64, error) {
+	value, err := strconv.ParseFloat(query.Get(name), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a valid number", name)
+	}
+	return value, nil
+}
+
+/*
+parsePhotoLocation is a helper function to get the location of a photo being uploaded.
+
+The location is read from the `latitude` and `longitude` fields if given, otherwise from the EXIF metadata of the
+image if the owner opted in via the `useExifLocation` field. If there is no location, it returns nil.
+*/
+func parsePhotoLocation(fields url.Values, image []byte) (*geo.Point, error) {
+	latitude := fields.Get("latitude")
+	longitude := fields.Get("longitude")
+
+	if latitude == "" && longitude == "" {
+		if fields.Get("useExifLocation") != "true" {
+			return nil, nil
+		}
+		location, err := geo.FromEXIF(image)
+		if errors.Is(err, geo.ErrNoLocation) {
+			return nil, nil
+		}
+		return &location, err
+	}
+
+	var location geo.Point
+	var err error
+	if location.Latitude, err = parseCoordinate(fields, "latitude"); err != nil {
+		return nil, err
+	}
+	if location.Longitude, err = parseCoordinate(fields, "longitude"); err != nil {
+		return nil, err
+	}
+	if !location.Valid() {
+		return nil, errors.New("latitude must be between -90 and 90, longitude between -180 and 180")
+	}
+	return &location, nil
+}
+
+/*
+getPhotosNearby Get the photos taken within a radius, in meters, from a location.
+The photos are sorted by distance, from nearest to farthest.
+
+	curl -X GET 'BASE_URL/photos/nearby?latitude=LATITUDE&longitude=LONGITUDE&radius=RADIUS' -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getPhotosNearby(w http.ResponseWriter, r *http.Request, _ httprouter.Params, _ reqcontext.RequestContext) {
+	var center geo.Point
+	radius := float64(defaultSearchRadius)
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the center of the search
+	query := r.URL.Query()
+	if center.Latitude, err = parseCoordinate(query, "latitude"); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if center.Longitude, err = parseCoordinate(query, "longitude"); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !center.Valid() {
+		respondWithJSONError(w, "latitude must be between -90 and 90, longitude between -180 and 180", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the radius of the search
+	if query.Get("radius") != "" {
+		radius, err = strconv.ParseFloat(query.Get("radius"), 64)
+		if err != nil {
+			respondWithJSONError(w, "radius must be a valid number", http.StatusBadRequest)
+			return
+		}
+	}
+	if radius <= 0 || radius > maxSearchRadius {
+		respondWithJSONError(w, fmt.Sprintf("radius must be between 0 and %d meters", maxSearchRadius), http.StatusBadRequest)
+		return
+	}
+
+	// Get the photos visible to the requester from the db
+	photos, err := rt.db.GetPhotosNearby(center, radius, header, maxSearchResults)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Apply the sensitive media setting of the requester
+	photos, err = rt.filterSensitive(header, photos)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the photos in the response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(photos)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+getPhotosInArea Get the photos taken inside a bounding box.
+The photos are sorted by date, from newest to oldest.
+
+	curl -X GET 'BASE_URL/photos/area?minLatitude=MIN_LAT&minLongitude=MIN_LON&maxLatitude=MAX_LAT&maxLongitude=MAX_LON' -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getPhotosInArea(w http.ResponseWriter, r *http.Request, _ httprouter.Params, _ reqcontext.RequestContext) {
+	var box geo.Box
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the bounding box
+	query := r.URL.Query()
+	if box.MinLatitude, err = parseCoordinate(query, "minLatitude"); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if box.MinLongitude, err = parseCoordinate(query, "minLongitude"); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if box.MaxLatitude, err = parseCoordinate(query, "maxLatitude"); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if box.MaxLongitude, err = parseCoordinate(query, "maxLongitude"); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !box.Valid() {
+		respondWithJSONError(w, "the bounding box must have valid coordinates, with minimums not greater than maximums", http.StatusBadRequest)
+		return
+	}
+
+	// Get the photos visible to the requester from the db
+	photos, err := rt.db.GetPhotosInArea(box, header, maxSearchResults)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Apply the sensitive media setting of the requester
+	photos, err = rt.filterSensitive(header, photos)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the photos in the response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(photos)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
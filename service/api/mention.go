@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+/*
+getMentionedPhotos Get the list of photos in which a user was mentioned, either in the caption or in a comment.
+
+	curl -X GET BASE_URL/users/USERNAME/mentions -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getMentionedPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var user User
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the username
+	user.Username = ps.ByName("username")
+	if err = validateString(usernamePattern, user.Username); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the mentioned user's data from the db
+	user, err = rt.db.GetUserProfile(user)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Get the photos visible to the requester from the db
+	photos, err := rt.db.GetMentionedPhotos(user.UserId, header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Apply the sensitive media setting of the requester
+	photos, err = rt.filterSensitive(header, photos)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the photos in the response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(photos)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
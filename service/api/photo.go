@@ -2,11 +2,14 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/imaging"
 	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
 	"github.com/julienschmidt/httprouter"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 )
@@ -14,14 +17,14 @@ import (
 /*
 getPhotoList Get the list of photos uploaded by a user.
 
-	curl -X GET BASE_URL/users/USERNAME/photos -H 'Authorization Bearer USER_ID' -H 'Content-Type: application/json'
+	curl -X GET 'BASE_URL/users/USERNAME/photos?cursor=CURSOR&limit=LIMIT' -H 'Authorization Bearer USER_ID' -H 'Content-Type: application/json'
 */
 func (rt *_router) getPhotoList(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
 	var user User
 	var targetUser User
 
 	// Get the requesters data from the auth header
-	_, err := parseAuthHeader(r.Header.Get("Authorization"))
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
 	if err != nil {
 		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
 		return
@@ -41,24 +44,37 @@ func (rt *_router) getPhotoList(w http.ResponseWriter, r *http.Request, ps httpr
 		return
 	}
 
+	// Validate the requested page
+	cursor, limit, err := parsePage(r.URL.Query())
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Get the photos from the db
-	photos, err := rt.db.GetPhotoList(targetUser.UserId)
+	photos, nextCursor, err := rt.db.GetPhotoList(targetUser.UserId, cursor, limit)
 	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		respondWithPageError(w, err)
 		return
 	}
 
-	// Return the photos in the response
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(photos)
+	// Apply the sensitive media setting of the requester
+	photos, err = rt.filterSensitive(header, photos)
 	if err != nil {
 		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	// Return the photos in the response
+	respondWithPage(w, photos, nextCursor)
 }
 
 /*
 uploadPhoto Upload a photo to the website and create a new post.
+The location can be given via the `latitude` and `longitude` fields, or read from the EXIF metadata of the image if
+the `useExifLocation` field is true.
+If the `edits` field is set to a JSON list of imaging.Operation, they are applied to the image before storing it.
+If the `publishAt` field is set, the photo stays hidden until then, when the scheduler publishes it.
 
 	curl -X POST BASE_URL/users/USERNAME/photos -H 'Authorization: Bearer USER_ID' -H 'Content-Type: multipart/form-data' -F 'image=@/path/to/photo' -F 'caption=CAPTION'
 */
@@ -103,35 +119,133 @@ func (rt *_router) uploadPhoto(w http.ResponseWriter, r *http.Request, ps httpro
 		return
 	}
 
-	// Get the mime type
-	photo.MimeType = r.FormValue("mimeType")
+	// Validate the other fields of the upload
+	photo, err = rt.newPhoto(r.Form, photo)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Upload the photo
+	photo, err = rt.createPhoto(photo)
+	if err != nil {
+		respondWithUploadError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created Photo object in the response, along with the warnings about it
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(uploadedPhoto{Photo: photo, Warnings: photoWarnings(photo)})
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+newPhoto is a helper function to fill a photo being uploaded from the fields of the upload, validating them.
+The image of the photo must already be set, as it may be edited or read for its location.
+It is shared by the multipart upload and the resumable uploads, whose metadata is given as fields.
+*/
+func (rt *_router) newPhoto(fields url.Values, photo Photo) (Photo, error) {
+	var err error
+
+	// Detect the mime type from the image itself, the one declared by the client is not trusted
+	photo.MimeType, err = imaging.DetectFormat(photo.Image)
+	if err != nil {
+		return Photo{}, err
+	}
+
+	// Apply the optional edits before storing the image
+	if edits := fields.Get("edits"); edits != "" {
+		var ops []imaging.Operation
+		if err = json.Unmarshal([]byte(edits), &ops); err != nil {
+			return Photo{}, err
+		}
+		photo.Image, photo.MimeType, err = imaging.Edit(photo.Image, ops)
+		if err != nil {
+			return Photo{}, err
+		}
+	}
+
+	// Convert the image to the storage format
+	photo, err = rt.transcodePhoto(photo)
+	if err != nil {
+		return Photo{}, err
+	}
 
 	// Get the caption
-	var caption = strings.TrimSpace(r.FormValue("caption"))
+	var caption = strings.TrimSpace(fields.Get("caption"))
 	// Validate the caption
 	if len(caption) > 0 {
 		if err = validateString(captionPattern, caption); err != nil {
-			respondWithJSONError(w, err.Error(), http.StatusBadRequest)
-			return
+			return Photo{}, err
 		}
 	}
 	photo.Caption = caption
 
-	// Upload the photo
-	photo, err = rt.db.UploadPhoto(photo)
+	// Get the optional alt text
+	var altText = strings.TrimSpace(fields.Get("altText"))
+	if err = validateString(altTextPattern, altText); err != nil {
+		return Photo{}, err
+	}
+	photo.AltText = altText
+
+	// Get the optional sensitive media mark
+	if sensitive := fields.Get("sensitive"); sensitive != "" {
+		photo.Sensitive, err = strconv.ParseBool(sensitive)
+		if err != nil {
+			return Photo{}, errors.New("sensitive must be a boolean")
+		}
+	}
+	var sensitiveReason = strings.TrimSpace(fields.Get("sensitiveReason"))
+	if err = validateString(sensitiveReasonPattern, sensitiveReason); err != nil {
+		return Photo{}, err
+	}
+	if photo.Sensitive {
+		photo.SensitiveReason = sensitiveReason
+		ownerId := photo.OwnerId
+		photo.SensitiveBy = &ownerId
+	}
+
+	// Get the optional location
+	location, err := parsePhotoLocation(fields, photo.Image)
 	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
-		return
+		return Photo{}, err
+	}
+	if location != nil {
+		photo.Latitude = &location.Latitude
+		photo.Longitude = &location.Longitude
 	}
 
-	// Return the created Photo object in the response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	err = json.NewEncoder(w).Encode(photo)
+	// Get the optional place name
+	var placeName = strings.TrimSpace(fields.Get("placeName"))
+	if err = validateString(placeNamePattern, placeName); err != nil {
+		return Photo{}, err
+	}
+	photo.PlaceName = placeName
+
+	// Get the optional publishing time
+	photo.PublishAt, err = parsePublishAt(fields)
 	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
-		return
+		return Photo{}, err
+	}
+
+	return photo, nil
+}
+
+/*
+createPhoto stores a new photo along with the users mentioned in its caption.
+If the photo would exceed the quota of its owner, it returns a QuotaExceededError.
+*/
+func (rt *_router) createPhoto(photo Photo) (Photo, error) {
+	quota, err := rt.getAppliedQuota(photo.OwnerId)
+	if err != nil {
+		return Photo{}, err
 	}
+
+	return rt.db.UploadPhoto(photo, quota, parseMentions(photo.Caption))
 }
 
 /*
@@ -169,3 +283,22 @@ func (rt *_router) deletePhoto(w http.ResponseWriter, r *http.Request, ps httpro
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusNoContent)
 }
+
+/*
+getVisiblePhoto is a helper function to get the photo of the request, which must be visible to the requester.
+Archived and scheduled photos are not found unless the requester is their owner.
+If any check fails, it responds with the error and returns false.
+*/
+func (rt *_router) getVisiblePhoto(w http.ResponseWriter, ps httprouter.Params, header uint) (Photo, bool) {
+	photoIdUint64, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return Photo{}, false
+	}
+	photo, err := rt.db.GetVisiblePhoto(uint(photoIdUint64), header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return Photo{}, false
+	}
+	return photo, true
+}
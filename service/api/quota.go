@@ -0,0 +1,249 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/globaltime"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isAdmin checks if a user is one of the admins given in the configuration.
+func (rt *_router) isAdmin(userId uint) bool {
+	return rt.admins[userId]
+}
+
+// getAppliedQuota Get the quota applied to a user, the one set by an admin or else the default one.
+func (rt *_router) getAppliedQuota(userId uint) (Quota, error) {
+	quota, err := rt.db.GetUserQuota(userId)
+	if err != nil {
+		return Quota{}, err
+	}
+	if quota != nil {
+		return *quota, nil
+	}
+	return rt.quota, nil
+}
+
+// getStorageUsage Get the storage used by a user, along with the quota applied to them.
+func (rt *_router) getStorageUsage(userId uint) (StorageUsage, error) {
+	usage, err := rt.db.GetStorageUsage(userId)
+	if err != nil {
+		return StorageUsage{}, err
+	}
+
+	usage.Quota, err = rt.getAppliedQuota(userId)
+	if err != nil {
+		return StorageUsage{}, err
+	}
+
+	return usage, nil
+}
+
+/*
+respondWithQuotaError is a helper function to respond to an upload exceeding a quota.
+The JSON object returned is the model.Error struct, along with the details of the exceeded limit.
+Exceeding a daily limit is reported as too many requests, with the time until the limit resets.
+*/
+func respondWithQuotaError(w http.ResponseWriter, quotaErr *QuotaExceededError) {
+	statusCode := http.StatusForbidden
+	if strings.HasPrefix(quotaErr.Limit, "maxDaily") {
+		statusCode = http.StatusTooManyRequests
+		now := globaltime.Now().UTC()
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		w.Header().Set("Retry-After", strconv.Itoa(int(tomorrow.Sub(now).Seconds())+1))
+	}
+
+	errResponse := struct {
+		Error
+		Quota *QuotaExceededError `json:"quota"`
+	}{
+		Error: Error{Code: statusCode, Message: quotaErr.Error()},
+		Quota: quotaErr,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(errResponse)
+}
+
+/*
+respondWithUploadError is a helper function to respond to a failed upload, using a structured error if it exceeded a
+quota, or a plain error with the given status code otherwise.
+Creating an upload while too many are open is reported as too many requests.
+*/
+func respondWithUploadError(w http.ResponseWriter, err error, statusCode int) {
+	var quotaErr *QuotaExceededError
+	var uploadsErr *TooManyUploadsError
+	if errors.As(err, &quotaErr) {
+		respondWithQuotaError(w, quotaErr)
+		return
+	} else if errors.As(err, &uploadsErr) {
+		respondWithJSONError(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	respondWithJSONError(w, err.Error(), statusCode)
+}
+
+/*
+getQuotaUser is a helper function to get the user identified by the `username` path parameter for the quota endpoints.
+On failure the error response is already written and false is returned.
+*/
+func (rt *_router) getQuotaUser(w http.ResponseWriter, ps httprouter.Params) (User, bool) {
+	var user User
+
+	// Validate the username
+	user.Username = ps.ByName("username")
+	if err := validateString(usernamePattern, user.Username); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return User{}, false
+	}
+
+	// Get the user's data from the db
+	user, err := rt.db.GetUserProfile(user)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return User{}, false
+	}
+
+	return user, true
+}
+
+/*
+getQuota Get the storage usage and the quota of a user.
+Only the user themselves and the admins can see it.
+
+	curl -X GET BASE_URL/users/USERNAME/quota -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getQuota(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the user's data from the db
+	user, ok := rt.getQuotaUser(w, ps)
+	if !ok {
+		return
+	}
+	if user.UserId != header && !rt.isAdmin(header) {
+		respondWithJSONError(w, "only the user and the admins can see the quota", http.StatusForbidden)
+		return
+	}
+
+	// Get the usage
+	usage, err := rt.getStorageUsage(user.UserId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the usage
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(usage)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+setQuota Set the quota of a user, replacing the default one. Only the admins can set it.
+A limit of 0 means unlimited. Photos already uploaded are kept, even if over the new quota.
+
+	curl -X PUT BASE_URL/users/USERNAME/quota -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json' -d '{"maxBytes": 104857600, "maxPhotos": 100, "maxDailyBytes": 0, "maxDailyPhotos": 10}'
+*/
+func (rt *_router) setQuota(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var quota Quota
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !rt.isAdmin(header) {
+		respondWithJSONError(w, "only the admins can set the quota", http.StatusForbidden)
+		return
+	}
+
+	// Get the user's data from the db
+	user, ok := rt.getQuotaUser(w, ps)
+	if !ok {
+		return
+	}
+
+	// Get the quota from the request body
+	err = json.NewDecoder(r.Body).Decode(&quota)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if quota.MaxBytes < 0 || quota.MaxPhotos < 0 || quota.MaxDailyBytes < 0 || quota.MaxDailyPhotos < 0 {
+		respondWithJSONError(w, "quota limits cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	// Set the quota
+	err = rt.db.SetUserQuota(user.UserId, quota)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the usage with the new quota
+	usage, err := rt.getStorageUsage(user.UserId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(usage)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+deleteQuota Restore the default quota of a user. Only the admins can restore it.
+
+	curl -X DELETE BASE_URL/users/USERNAME/quota -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) deleteQuota(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !rt.isAdmin(header) {
+		respondWithJSONError(w, "only the admins can restore the quota", http.StatusForbidden)
+		return
+	}
+
+	// Get the user's data from the db
+	user, ok := rt.getQuotaUser(w, ps)
+	if !ok {
+		return
+	}
+
+	// Remove the quota of the user
+	err = rt.db.DeleteUserQuota(user.UserId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+}
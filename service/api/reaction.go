@@ -0,0 +1,245 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strings"
+)
+
+// defaultReactions is the list of reactions users can choose from when none is configured, the first one is the like.
+var defaultReactions = []string{"❤️", "👍", "😂", "😮", "😢", "😡"}
+
+/*
+parseReaction is a helper function to validate a reaction among the available ones.
+An empty reaction is the like, the first of the list.
+*/
+func (rt *_router) parseReaction(reaction string) (string, bool) {
+	if reaction == "" {
+		return rt.reactions[0], true
+	}
+	for _, available := range rt.reactions {
+		if reaction == available {
+			return reaction, true
+		}
+	}
+	return "", false
+}
+
+/*
+getRequesterReactableComment is a helper function to get the comment in the path, if the requester can react to it.
+Deleted comments cannot be reacted to, nor the ones whose owner, or the owner of their photo, banned the requester.
+It responds with the error and returns false otherwise.
+*/
+func (rt *_router) getRequesterReactableComment(w http.ResponseWriter, ps httprouter.Params, header uint) (Photo, Comment, bool) {
+	photo, comment, ok := rt.getRequesterComment(w, ps, header)
+	if !ok {
+		return Photo{}, Comment{}, false
+	}
+	if comment.Deleted {
+		respondWithJSONError(w, (&CommentNotFoundError{CommentId: comment.CommentId}).Error(), http.StatusNotFound)
+		return Photo{}, Comment{}, false
+	}
+
+	// Check if the requester was banned by the owner of the photo or of the comment
+	for _, ownerId := range []uint{photo.OwnerId, comment.OwnerId} {
+		isBanned, err := rt.db.GetBanStatus(ownerId, header)
+		if err != nil {
+			respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+			return Photo{}, Comment{}, false
+		}
+		if isBanned {
+			respondWithJSONError(w, "you were banned by the owner of the photo or of the comment", http.StatusForbidden)
+			return Photo{}, Comment{}, false
+		}
+	}
+
+	return photo, comment, true
+}
+
+/*
+reactToComment Set the reaction of the requester to a comment, replacing their previous one.
+Without a reaction, the comment is liked.
+
+	curl -X PUT BASE_URL/users/USERNAME/photos/PHOTO_ID/comments/COMMENT_ID/reaction -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json' -d '{"reaction": "REACTION"}'
+*/
+func (rt *_router) reactToComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var body struct {
+		Reaction string `json:"reaction"`
+	}
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the comment's data from the db
+	photo, comment, ok := rt.getRequesterReactableComment(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Get the reaction from the request body, which is optional
+	if r.ContentLength != 0 {
+		err = json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	reaction, ok := rt.parseReaction(body.Reaction)
+	if !ok {
+		respondWithJSONError(w, "reaction must be one of "+strings.Join(rt.reactions, " "), http.StatusBadRequest)
+		return
+	}
+
+	// React to the comment
+	err = rt.db.ReactToComment(comment.CommentId, header, reaction)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the updated comment
+	comment, err = rt.db.GetComment(photo.PhotoId, comment.CommentId, header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(comment)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+unreactToComment Remove the reaction of the requester to a comment.
+
+	curl -X DELETE BASE_URL/users/USERNAME/photos/PHOTO_ID/comments/COMMENT_ID/reaction -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) unreactToComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the comment's data from the db
+	_, comment, ok := rt.getRequesterComment(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Remove the reaction
+	err = rt.db.UnreactToComment(comment.CommentId, header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+getReactions Get the reactions users can choose from, the first one is the like.
+
+	curl -X GET BASE_URL/reactions -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getReactions(w http.ResponseWriter, r *http.Request, _ httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	_, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Return the reactions
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(rt.reactions)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+reactToPhoto Set the reaction of the requester to a photo, replacing their previous one.
+Without a reaction, the photo is liked.
+
+	curl -X PUT BASE_URL/users/USERNAME/photos/PHOTO_ID/reaction -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json' -d '{"reaction": "REACTION"}'
+*/
+func (rt *_router) reactToPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var body struct {
+		Reaction string `json:"reaction"`
+	}
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the photo's data from the db
+	photo, ok := rt.getVisiblePhoto(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Check if the requester was banned by the owner of the photo
+	isBanned, err := rt.db.GetBanStatus(photo.OwnerId, header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if isBanned {
+		respondWithJSONError(w, "you were banned by the owner of the photo", http.StatusForbidden)
+		return
+	}
+
+	// Get the reaction from the request body, which is optional
+	if r.ContentLength != 0 {
+		err = json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	reaction, ok := rt.parseReaction(body.Reaction)
+	if !ok {
+		respondWithJSONError(w, "reaction must be one of "+strings.Join(rt.reactions, " "), http.StatusBadRequest)
+		return
+	}
+
+	// React to the photo
+	err = rt.db.ReactToPhoto(header, photo.PhotoId, reaction)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the updated photo
+	photo, err = rt.db.GetPhoto(photo.PhotoId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(photo)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/globaltime"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/*
+parsePublishAt Parse the optional `publishAt` field of an upload, an RFC 3339 time in the future.
+A nil time is returned if the photo should be published right away.
+*/
+func parsePublishAt(fields url.Values) (*string, error) {
+	value := strings.TrimSpace(fields.Get("publishAt"))
+	if value == "" {
+		return nil, nil
+	}
+
+	publishAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errors.New("publishAt must be an RFC 3339 time")
+	}
+	if !publishAt.After(globaltime.Now()) {
+		return nil, errors.New("publishAt must be in the future")
+	}
+
+	// Times are stored in UTC, so that they can be compared as strings
+	formatted := publishAt.UTC().Format(time.RFC3339)
+	return &formatted, nil
+}
+
+/*
+publishScheduledPhotos Publish the scheduled photos that are due, run periodically by the scheduler worker.
+Once published, a photo is shown on the profile of its owner and in the streams of their followers, along with the
+mentions in its caption, as those are all read from the published photos, and it is counted in the photos of the owner.
+There are no notifications to send, as the users are not notified of new photos.
+*/
+func (rt *_router) publishScheduledPhotos() error {
+	photos, err := rt.db.PublishDuePhotos(globaltime.Now())
+	for _, photo := range photos {
+		rt.baseLogger.WithField("photoId", photo.PhotoId).Info("scheduled photo published")
+	}
+	return err
+}
+
+/*
+getScheduledPhotos Get the list of photos of the user waiting to be published.
+Only the owner of the photos can see them.
+
+	curl -X GET BASE_URL/users/USERNAME/scheduled -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getScheduledPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var user User
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the username
+	user.Username = ps.ByName("username")
+	if err = validateString(usernamePattern, user.Username); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the user's data from the db
+	user, err = rt.db.GetUserProfile(user)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if user.UserId != header {
+		respondWithJSONError(w, "only the owner can see their scheduled photos", http.StatusForbidden)
+		return
+	}
+
+	// Get the scheduled photos from the db
+	photos, err := rt.db.GetScheduledPhotos(user.UserId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the photos in the response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(photos)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
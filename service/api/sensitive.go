@@ -0,0 +1,287 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Ways of showing the photos marked as sensitive, chosen by each user in their Settings.
+const (
+	sensitiveShow = "show"
+	sensitiveBlur = "blur"
+	sensitiveHide = "hide"
+)
+
+// isModerator checks if a user is one of the moderators given in the configuration, or an admin.
+func (rt *_router) isModerator(userId uint) bool {
+	return rt.moderators[userId] || rt.isAdmin(userId)
+}
+
+/*
+filterSensitive is a helper function to apply the sensitive media setting of a viewer to a list of photos.
+Sensitive photos are removed when the viewer hides them, and marked as Blurred when they blur them.
+The photos of the viewer themselves are always shown.
+*/
+func (rt *_router) filterSensitive(viewerId uint, photos []Photo) ([]Photo, error) {
+	settings, err := rt.db.GetSettings(viewerId)
+	if err != nil {
+		return nil, err
+	}
+	if settings.SensitiveMedia == sensitiveShow {
+		return photos, nil
+	}
+
+	filtered := make([]Photo, 0, len(photos))
+	for _, photo := range photos {
+		if photo.Sensitive && photo.OwnerId != viewerId {
+			if settings.SensitiveMedia == sensitiveHide {
+				continue
+			}
+			photo.Blurred = true
+		}
+		filtered = append(filtered, photo)
+	}
+	return filtered, nil
+}
+
+/*
+getRequesterSensitivePhoto is a helper function to get the photo whose sensitive mark the requester wants to change.
+Only the owner of the photo and the moderators can change it, but only the moderators can change the mark they set.
+If any check fails, it responds with the error and returns false.
+*/
+func (rt *_router) getRequesterSensitivePhoto(w http.ResponseWriter, ps httprouter.Params, header uint) (Photo, bool) {
+	// Get the photo's data from the db
+	photoIdUint64, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return Photo{}, false
+	}
+	photo, err := rt.db.GetPhoto(uint(photoIdUint64))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return Photo{}, false
+	}
+
+	// Check the permissions of the requester
+	if rt.isModerator(header) {
+		return photo, true
+	}
+	if photo.OwnerId != header {
+		respondWithJSONError(w, "only the owner of the photo and the moderators can mark it as sensitive", http.StatusForbidden)
+		return Photo{}, false
+	}
+	if photo.Sensitive && photo.SensitiveBy != nil && *photo.SensitiveBy != photo.OwnerId {
+		respondWithJSONError(w, "the photo was marked as sensitive by a moderator", http.StatusForbidden)
+		return Photo{}, false
+	}
+
+	return photo, true
+}
+
+/*
+markSensitive Mark a photo as sensitive media, with an optional reason shown as content warning.
+The owner of the photo can mark it, and the moderators can mark the photos of anyone.
+
+	curl -X PUT BASE_URL/users/USERNAME/photos/PHOTO_ID/sensitive -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json' -d '{"reason": "REASON"}'
+*/
+func (rt *_router) markSensitive(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the photo's data from the db
+	photo, ok := rt.getRequesterSensitivePhoto(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Get the reason from the request body
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reason := strings.TrimSpace(body.Reason)
+	if err = validateString(sensitiveReasonPattern, reason); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Update the photo
+	err = rt.db.SetPhotoSensitive(photo.PhotoId, reason, header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	photo.Sensitive = true
+	photo.SensitiveReason = reason
+	photo.SensitiveBy = &header
+
+	// Return the updated photo
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(photo)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+unmarkSensitive Remove the sensitive media mark from a photo.
+A mark set by a moderator can only be removed by a moderator.
+
+	curl -X DELETE BASE_URL/users/USERNAME/photos/PHOTO_ID/sensitive -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) unmarkSensitive(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the photo's data from the db
+	photo, ok := rt.getRequesterSensitivePhoto(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Update the photo
+	err = rt.db.UnsetPhotoSensitive(photo.PhotoId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+getRequesterSettingsUser is a helper function to get the user whose settings are requested, who must be the requester.
+If any check fails, it responds with the error and returns false.
+*/
+func (rt *_router) getRequesterSettingsUser(w http.ResponseWriter, ps httprouter.Params, header uint) (User, bool) {
+	var user User
+
+	// Validate the username
+	user.Username = ps.ByName("username")
+	if err := validateString(usernamePattern, user.Username); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return User{}, false
+	}
+
+	// Get the user's data from the db
+	user, err := rt.db.GetUserProfile(user)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return User{}, false
+	}
+	if user.UserId != header {
+		respondWithJSONError(w, "only the user can access their settings", http.StatusForbidden)
+		return User{}, false
+	}
+
+	return user, true
+}
+
+/*
+getSettings Get the settings of the requester.
+
+	curl -X GET BASE_URL/users/USERNAME/settings -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getSettings(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the user's data from the db
+	user, ok := rt.getRequesterSettingsUser(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Get the settings from the db
+	settings, err := rt.db.GetSettings(user.UserId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the settings
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(settings)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+setSettings Replace the settings of the requester.
+
+	curl -X PUT BASE_URL/users/USERNAME/settings -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json' -d '{"sensitiveMedia": "blur"}'
+*/
+func (rt *_router) setSettings(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var settings Settings
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the user's data from the db
+	user, ok := rt.getRequesterSettingsUser(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Get the settings from the request body
+	err = json.NewDecoder(r.Body).Decode(&settings)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch settings.SensitiveMedia {
+	case sensitiveShow, sensitiveBlur, sensitiveHide:
+	default:
+		respondWithJSONError(w, "sensitiveMedia must be show, blur or hide", http.StatusBadRequest)
+		return
+	}
+
+	// Update the settings
+	err = rt.db.SetSettings(user.UserId, settings)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the updated settings
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(settings)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -1,6 +1,13 @@
 package api
 
 // Close should close everything opened in the lifecycle of the `_router`; for example, background goroutines.
+// The views still buffered are written to the db once the workers are stopped.
 func (rt *_router) Close() error {
-	return nil
+	var err error
+	rt.closeOnce.Do(func() {
+		close(rt.done)
+		rt.workers.Wait()
+		err = rt.flushViews()
+	})
+	return err
 }
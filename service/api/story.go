@@ -0,0 +1,404 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/globaltime"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/imaging"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// storyLifetime is how long a story is shown after being posted, before being deleted.
+const storyLifetime = 24 * time.Hour
+
+// storyReapInterval is how often the expired stories are deleted.
+const storyReapInterval = 10 * time.Minute
+
+// deleteExpiredStories Delete the stories that expired, along with their images and views.
+func (rt *_router) deleteExpiredStories() error {
+	deleted, err := rt.db.DeleteExpiredStories(globaltime.Now())
+	if deleted > 0 {
+		rt.baseLogger.WithField("stories", deleted).Info("expired stories deleted")
+	}
+	return err
+}
+
+/*
+getRequesterStory is a helper function to get an active story of the user in the path, visible to the requester.
+If the story does not exist, belongs to someone else, or its owner banned the requester, it responds with the error
+and returns false.
+*/
+func (rt *_router) getRequesterStory(w http.ResponseWriter, ps httprouter.Params, header uint) (Story, bool) {
+	// Validate the username
+	username := ps.ByName("username")
+	if err := validateString(usernamePattern, username); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return Story{}, false
+	}
+
+	// Get the story's data from the db
+	storyIdUint64, err := strconv.ParseUint(ps.ByName("storyId"), 10, 64)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return Story{}, false
+	}
+	story, err := rt.db.GetStory(uint(storyIdUint64), header, globaltime.Now())
+	if err != nil {
+		var notFound *StoryNotFoundError
+		if errors.As(err, &notFound) {
+			respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		} else {
+			respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return Story{}, false
+	}
+	if story.OwnerUsername != username {
+		respondWithJSONError(w, (&StoryNotFoundError{StoryId: story.StoryId}).Error(), http.StatusNotFound)
+		return Story{}, false
+	}
+
+	// Check if the requester was banned by the owner of the story
+	isBanned, err := rt.db.GetBanStatus(story.OwnerId, header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return Story{}, false
+	}
+	if isBanned {
+		respondWithJSONError(w, "you were banned by the owner of the story", http.StatusForbidden)
+		return Story{}, false
+	}
+
+	return story, true
+}
+
+/*
+getFollowedStories Get the active stories of the users followed by the requester, grouped by author.
+Within each group, the stories are sorted from oldest to newest, and flagged if already seen.
+
+	curl -X GET BASE_URL/stories -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getFollowedStories(w http.ResponseWriter, r *http.Request, _ httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the stories from the db, they are sorted by author
+	stories, err := rt.db.GetFollowedStories(header, globaltime.Now())
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Group the stories by author
+	groups := make([]StoryGroup, 0)
+	for _, story := range stories {
+		if len(groups) == 0 || groups[len(groups)-1].UserId != story.OwnerId {
+			groups = append(groups, StoryGroup{UserId: story.OwnerId, Username: story.OwnerUsername})
+		}
+		group := &groups[len(groups)-1]
+		group.Stories = append(group.Stories, story)
+	}
+
+	// Return the groups in the response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(groups)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+getUserStories Get the active stories of a user, from oldest to newest.
+
+	curl -X GET BASE_URL/users/USERNAME/stories -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getUserStories(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var user User
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the username
+	user.Username = ps.ByName("username")
+	if err = validateString(usernamePattern, user.Username); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the user's data from the db
+	user, err = rt.db.GetUserProfile(user)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Check if the requester was banned by the user
+	isBanned, err := rt.db.GetBanStatus(user.UserId, header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if isBanned {
+		respondWithJSONError(w, "you were banned by the user", http.StatusForbidden)
+		return
+	}
+
+	// Get the stories from the db
+	stories, err := rt.db.GetUserStories(user.UserId, header, globaltime.Now())
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the stories in the response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(stories)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+createStory Post a new story, shown to the followers of the requester for 24 hours.
+
+	curl -X POST BASE_URL/users/USERNAME/stories -H 'Authorization: Bearer USER_ID' -H 'Content-Type: multipart/form-data' -F 'image=@/path/to/image.jpg' -F 'caption=CAPTION'
+*/
+func (rt *_router) createStory(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var story Story
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	story.OwnerId = header
+
+	// Validate the username
+	username := ps.ByName("username")
+	if err = validateString(usernamePattern, username); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	story.OwnerUsername = username
+
+	// Parse the multipart form data
+	err = r.ParseMultipartForm(10 << 20)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the image file
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// Read the image file, detect its format and convert it to the storage format
+	image, err := io.ReadAll(file)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	mimeType, err := imaging.DetectFormat(image)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	converted, err := rt.transcodePhoto(Photo{Image: image, MimeType: mimeType})
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	story.Image = converted.Image
+	story.MimeType = converted.MimeType
+
+	// Get the caption
+	story.Caption = strings.TrimSpace(r.FormValue("caption"))
+	if err = validateString(captionPattern, story.Caption); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Set the lifetime of the story
+	now := globaltime.Now().UTC()
+	story.CreatedAt = now.Format(time.RFC3339)
+	story.ExpiresAt = now.Add(storyLifetime).Format(time.RFC3339)
+
+	// Create the story, its image counts against the quota of the requester
+	quota, err := rt.getAppliedQuota(header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	story, err = rt.db.CreateStory(story, quota)
+	if err != nil {
+		respondWithUploadError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created story
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(story)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+getStoryImage Get the image of a story, which the lists of stories leave out.
+
+	curl -X GET BASE_URL/users/USERNAME/stories/STORY_ID/image -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getStoryImage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the story's data from the db
+	story, ok := rt.getRequesterStory(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Return the image
+	w.Header().Set("Content-Type", story.MimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(story.Image)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(story.Image)
+}
+
+/*
+deleteStory Delete a story before it expires.
+
+	curl -X DELETE BASE_URL/users/USERNAME/stories/STORY_ID -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) deleteStory(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the story's data from the db
+	story, ok := rt.getRequesterStory(w, ps, header)
+	if !ok {
+		return
+	}
+	if story.OwnerId != header {
+		respondWithJSONError(w, "only the owner of the story can delete it", http.StatusForbidden)
+		return
+	}
+
+	// Delete the story
+	err = rt.db.DeleteStory(story.StoryId, story.OwnerId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+viewStory Record that the requester has seen a story. The views of the owner are not recorded.
+
+	curl -X POST BASE_URL/users/USERNAME/stories/STORY_ID/views -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) viewStory(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the story's data from the db
+	story, ok := rt.getRequesterStory(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Record the view
+	if story.OwnerId != header {
+		err = rt.db.MarkStorySeen(story.StoryId, header)
+		if err != nil {
+			respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Return success
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+getStoryViews Get the users who have seen a story, from the first to the last one.
+Only the owner of the story can see them.
+
+	curl -X GET BASE_URL/users/USERNAME/stories/STORY_ID/views -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getStoryViews(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the story's data from the db
+	story, ok := rt.getRequesterStory(w, ps, header)
+	if !ok {
+		return
+	}
+	if story.OwnerId != header {
+		respondWithJSONError(w, "only the owner of the story can see who has seen it", http.StatusForbidden)
+		return
+	}
+
+	// Get the views from the db
+	views, err := rt.db.GetStoryViews(story.StoryId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the views in the response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(views)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
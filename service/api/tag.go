@@ -0,0 +1,272 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+)
+
+/*
+getPhotoTags Get all users tagged in a photo.
+
+	curl -X GET BASE_URL/users/USERNAME/photos/PHOTO_ID/tags -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getPhotoTags(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the photo's data from the db
+	photo, ok := rt.getVisiblePhoto(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Check if the requester was banned by the owner of the photo
+	isBanned, err := rt.db.GetBanStatus(photo.OwnerId, header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if isBanned {
+		respondWithJSONError(w, "you were banned by the owner of the photo", http.StatusForbidden)
+		return
+	}
+
+	// Get the tags from the db
+	tags, err := rt.db.GetPhotoTags(photo.PhotoId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the tags
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(tags)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+tagUser Tag a user in a photo at the given normalized position.
+Only the owner of the photo can tag users, and only users not banned by or banning them.
+
+	curl -X PUT BASE_URL/users/USERNAME/photos/PHOTO_ID/tags/TARGET_USERNAME -H 'Authorization: Bearer USER_ID' -H 'Content-Type: application/json' -d '{"x": 0.5, "y": 0.5}'
+*/
+func (rt *_router) tagUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var targetUser User
+	var tag Tag
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the username
+	if err = validateString(usernamePattern, ps.ByName("username")); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the target username
+	targetUser.Username = ps.ByName("targetUsername")
+	if err = validateString(usernamePattern, targetUser.Username); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the photo's data from the db
+	photoIdUint64, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	photo, err := rt.db.GetPhoto(uint(photoIdUint64))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if photo.OwnerId != header {
+		respondWithJSONError(w, "only the owner of the photo can tag users", http.StatusForbidden)
+		return
+	}
+
+	// Get the tag's position from the request body
+	err = json.NewDecoder(r.Body).Decode(&tag)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if tag.X < 0 || tag.X > 1 || tag.Y < 0 || tag.Y > 1 {
+		respondWithJSONError(w, "tag position must be between 0 and 1", http.StatusBadRequest)
+		return
+	}
+
+	// Get the target user's data from the db
+	targetUser, err = rt.db.GetUserProfile(targetUser)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Check that neither user has banned the other
+	hasBanned, err := rt.db.GetBanStatus(photo.OwnerId, targetUser.UserId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	isBanned, err := rt.db.GetBanStatus(targetUser.UserId, photo.OwnerId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hasBanned || isBanned {
+		respondWithJSONError(w, "cannot tag a user involved in a ban with the owner of the photo", http.StatusForbidden)
+		return
+	}
+
+	// Tag the target user
+	tag.PhotoId = photo.PhotoId
+	tag.UserId = targetUser.UserId
+	tag.Username = targetUser.Username
+	err = rt.db.TagUser(tag)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the tag
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(tag)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/*
+untagUser Remove the tag of a user from a photo.
+Both the owner of the photo and the tagged user can remove the tag.
+
+	curl -X DELETE BASE_URL/users/USERNAME/photos/PHOTO_ID/tags/TARGET_USERNAME -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) untagUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var targetUser User
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the target username
+	targetUser.Username = ps.ByName("targetUsername")
+	if err = validateString(usernamePattern, targetUser.Username); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the target user's data from the db
+	targetUser, err = rt.db.GetUserProfile(targetUser)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Get the photo's data from the db
+	photo, ok := rt.getVisiblePhoto(w, ps, header)
+	if !ok {
+		return
+	}
+	if photo.OwnerUsername != ps.ByName("username") {
+		respondWithJSONError(w, "photo does not exist", http.StatusNotFound)
+		return
+	}
+	if photo.OwnerId != header && targetUser.UserId != header {
+		respondWithJSONError(w, "only the owner of the photo or the tagged user can remove a tag", http.StatusForbidden)
+		return
+	}
+
+	// Untag the target user
+	err = rt.db.UntagUser(photo.PhotoId, targetUser.UserId)
+	if err != nil {
+		var notFound *TagNotFoundError
+		if errors.As(err, &notFound) {
+			respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		} else {
+			respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Return success
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+getTaggedPhotos Get the list of photos in which a user was tagged.
+
+	curl -X GET BASE_URL/users/USERNAME/tagged -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getTaggedPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var user User
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the username
+	user.Username = ps.ByName("username")
+	if err = validateString(usernamePattern, user.Username); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the tagged user's data from the db
+	user, err = rt.db.GetUserProfile(user)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Get the photos visible to the requester from the db
+	photos, err := rt.db.GetTaggedPhotos(user.UserId, header)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Apply the sensitive media setting of the requester
+	photos, err = rt.filterSensitive(header, photos)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the photos in the response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(photos)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,424 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/globaltime"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Resumable uploads follow the core tus protocol 1.0.0 (https://tus.io/protocols/resumable-upload), along with its
+creation, termination and expiration extensions. An upload is created with its total length and the fields of the
+photo as metadata, then its data is sent with one or more PATCH requests, each resuming at the offset returned by HEAD.
+Once all the data is received, the upload is turned into a Photo as if it was sent to uploadPhoto.
+*/
+const (
+	// tusVersion is the only version of the tus protocol supported.
+	tusVersion = "1.0.0"
+
+	// tusExtensions is the list of the supported tus extensions.
+	tusExtensions = "creation,termination,expiration"
+
+	// maxUploadSize is the maximum length of a resumable upload, in bytes.
+	maxUploadSize = 32 << 20
+
+	// maxOpenUploads is the maximum number of uploads a user can have open at once.
+	maxOpenUploads = 10
+
+	// uploadChunkSize is the maximum size of the chunks stored in the db, in bytes.
+	uploadChunkSize = 1 << 20
+
+	// uploadExpiration is how long an upload can be resumed, or queried once complete.
+	uploadExpiration = 24 * time.Hour
+
+	// uploadReapInterval is how often expired uploads are deleted.
+	uploadReapInterval = time.Hour
+
+	// uploadContentType is the content type of the PATCH requests.
+	uploadContentType = "application/offset+octet-stream"
+)
+
+/*
+checkTusResumable is a helper function to check the version of the tus protocol used by the client, and to set the
+`Tus-Resumable` header of the response. On failure the error response is already written and false is returned.
+*/
+func checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		respondWithJSONError(w, "unsupported tus version, only "+tusVersion+" is supported", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+/*
+parseUploadMetadata is a helper function to parse the `Upload-Metadata` header into the fields of the photo.
+The header is a comma separated list of keys, each followed by a space and its base64 encoded value, if any.
+The common `filetype` key is accepted but ignored, as the format of the photo is detected from the uploaded image.
+*/
+func parseUploadMetadata(header string) (url.Values, error) {
+	fields := make(url.Values)
+	if strings.TrimSpace(header) == "" {
+		return fields, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("invalid Upload-Metadata header, empty key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata header, the value of `%s` is not base64", key)
+		}
+		fields.Set(key, string(value))
+	}
+	return fields, nil
+}
+
+// uploadExpires returns the value of the `Upload-Expires` header of an upload.
+func uploadExpires(upload Upload) string {
+	createdAt, err := time.Parse(time.RFC3339, upload.CreatedAt)
+	if err != nil {
+		return ""
+	}
+	return createdAt.Add(uploadExpiration).UTC().Format(http.TimeFormat)
+}
+
+/*
+getRequesterUpload Get the upload identified by the `uploadId` path parameter.
+Uploads are private, so an upload of another user is reported as not found.
+On failure the error response is already written and false is returned.
+*/
+func (rt *_router) getRequesterUpload(w http.ResponseWriter, ps httprouter.Params, header uint) (Upload, bool) {
+	upload, err := rt.db.GetUpload(ps.ByName("uploadId"), header)
+	if err != nil {
+		var notFound *UploadNotFoundError
+		if errors.As(err, &notFound) {
+			respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		} else {
+			respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return Upload{}, false
+	}
+	return upload, true
+}
+
+// deleteExpiredUploads Delete the expired uploads, run periodically by the uploads worker.
+func (rt *_router) deleteExpiredUploads() error {
+	deleted, err := rt.db.DeleteExpiredUploads(globaltime.Now().Add(-uploadExpiration))
+	if deleted > 0 {
+		rt.baseLogger.WithField("uploads", deleted).Info("expired uploads deleted")
+	}
+	return err
+}
+
+/*
+getUploadOptions Describe the resumable uploads supported by the server, as the tus discovery request.
+The request does not need the `Tus-Resumable` header, as the client may not know the supported versions yet.
+
+	curl -X OPTIONS BASE_URL/users/USERNAME/uploads
+*/
+func (rt *_router) getUploadOptions(w http.ResponseWriter, _ *http.Request, _ httprouter.Params, _ reqcontext.RequestContext) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.Itoa(maxUploadSize))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+createUpload Create a resumable upload, given its total length and the fields of the photo as metadata.
+The fields are the same as the ones of uploadPhoto, and are validated once the upload is complete.
+The length counts against the quota of the requester until the upload is complete, deleted or expired, and each user
+can have up to maxOpenUploads open uploads.
+
+	curl -X POST BASE_URL/users/USERNAME/uploads -H 'Authorization: Bearer USER_ID' -H 'Tus-Resumable: 1.0.0' -H 'Upload-Length: LENGTH' -H 'Upload-Metadata: caption Q0FQVElPTg=='
+*/
+func (rt *_router) createUpload(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	var upload Upload
+
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	upload.OwnerId = header
+
+	// Validate the username
+	if err = validateString(usernamePattern, ps.ByName("username")); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the protocol version
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	// Get the length of the upload, deferring it is not supported
+	upload.Length, err = strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || upload.Length <= 0 {
+		respondWithJSONError(w, "Upload-Length must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	if upload.Length > maxUploadSize {
+		w.Header().Set("Tus-Max-Size", strconv.Itoa(maxUploadSize))
+		respondWithJSONError(w, fmt.Sprintf("uploads cannot exceed %d bytes", maxUploadSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Check the metadata, the fields it contains are validated when the upload is complete
+	upload.Metadata = r.Header.Get("Upload-Metadata")
+	if _, err = parseUploadMetadata(upload.Metadata); err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Create the upload, its length counts against the quota until it is complete
+	quota, err := rt.getAppliedQuota(upload.OwnerId)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	upload, err = rt.db.CreateUpload(upload, quota, maxOpenUploads)
+	if err != nil {
+		respondWithUploadError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Return the location of the upload
+	w.Header().Set("Location", "/users/"+ps.ByName("username")+"/uploads/"+upload.UploadId)
+	w.Header().Set("Upload-Expires", uploadExpires(upload))
+	w.WriteHeader(http.StatusCreated)
+}
+
+/*
+getUploadOffset Get the number of bytes received by a resumable upload, to know where to resume it.
+Once the upload is complete, the id of the created photo is returned in the `Photo-Id` header.
+
+	curl -I BASE_URL/users/USERNAME/uploads/UPLOAD_ID -H 'Authorization: Bearer USER_ID' -H 'Tus-Resumable: 1.0.0'
+*/
+func (rt *_router) getUploadOffset(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the protocol version
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	// Get the upload's data from the db
+	upload, ok := rt.getRequesterUpload(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Return the state of the upload
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Expires", uploadExpires(upload))
+	if upload.PhotoId != nil {
+		w.Header().Set("Photo-Id", strconv.FormatUint(uint64(*upload.PhotoId), 10))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+/*
+resumeUpload Append data to a resumable upload, starting at its current offset.
+The data is stored as it arrives, so that an interrupted request can be resumed from the last byte received.
+Once all the data is received, the photo is created and its id is returned in the `Photo-Id` header.
+
+	curl -X PATCH BASE_URL/users/USERNAME/uploads/UPLOAD_ID -H 'Authorization: Bearer USER_ID' -H 'Tus-Resumable: 1.0.0' -H 'Upload-Offset: OFFSET' -H 'Content-Type: application/offset+octet-stream' --data-binary @/path/to/chunk
+*/
+func (rt *_router) resumeUpload(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the protocol version and the content type
+	if !checkTusResumable(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != uploadContentType {
+		respondWithJSONError(w, "Content-Type must be "+uploadContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Get the upload's data from the db
+	upload, ok := rt.getRequesterUpload(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Check that the data starts at the current offset, and does not exceed the length
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		respondWithJSONError(w, "Upload-Offset must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+	if offset != upload.Offset {
+		respondWithJSONError(w, (&UploadOffsetMismatchError{Offset: upload.Offset}).Error(), http.StatusConflict)
+		return
+	}
+	if r.ContentLength > upload.Length-upload.Offset {
+		respondWithJSONError(w, "the data exceeds the length of the upload", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Store the data in chunks as it arrives, stopping at the end of the body or of the upload
+	body := io.LimitReader(r.Body, upload.Length-upload.Offset)
+	for upload.Offset < upload.Length {
+		size := upload.Length - upload.Offset
+		if size > uploadChunkSize {
+			size = uploadChunkSize
+		}
+		chunk := make([]byte, size)
+		read, readErr := io.ReadFull(body, chunk)
+		if read > 0 {
+			upload, err = rt.db.AppendUploadChunk(upload, chunk[:read])
+			if err != nil {
+				var mismatch *UploadOffsetMismatchError
+				if errors.As(err, &mismatch) {
+					respondWithJSONError(w, err.Error(), http.StatusConflict)
+				} else {
+					respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+		}
+		if readErr != nil {
+			if !errors.Is(readErr, io.EOF) && !errors.Is(readErr, io.ErrUnexpectedEOF) {
+				ctx.Logger.WithError(readErr).Warning("upload interrupted, it can be resumed")
+			}
+			break
+		}
+	}
+
+	// Create the photo once all the data is received, unless a concurrent request is already creating it
+	if upload.Offset == upload.Length && upload.PhotoId == nil {
+		claimed, err := rt.db.ClaimUpload(upload.UploadId)
+		if err != nil {
+			respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if claimed {
+			photo, status, err := rt.finishUpload(upload, ps.ByName("username"))
+			if err != nil {
+				respondWithUploadError(w, err, status)
+				return
+			}
+			w.Header().Set("Photo-Id", strconv.FormatUint(uint64(photo.PhotoId), 10))
+		}
+	}
+
+	// Return the new offset
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", uploadExpires(upload))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+finishUpload Create the photo of a complete upload claimed via ClaimUpload, validating the fields in its metadata.
+If they are invalid, the upload cannot be completed and it is deleted.
+If the photo cannot be created, for example as it would exceed the quota of the owner, the upload is released so
+that it can be completed later.
+On failure, it also returns the HTTP status to respond with.
+*/
+func (rt *_router) finishUpload(upload Upload, username string) (Photo, int, error) {
+	var photo Photo
+	photo.OwnerId = upload.OwnerId
+	photo.OwnerUsername = username
+
+	// Join the chunks of the upload
+	data, err := rt.db.GetUploadData(upload.UploadId)
+	if err != nil {
+		if releaseErr := rt.db.ReleaseUpload(upload.UploadId); releaseErr != nil {
+			return Photo{}, http.StatusInternalServerError, releaseErr
+		}
+		return Photo{}, http.StatusInternalServerError, err
+	}
+	photo.Image = data
+
+	// Validate the fields of the photo
+	fields, err := parseUploadMetadata(upload.Metadata)
+	if err == nil {
+		photo, err = rt.newPhoto(fields, photo)
+	}
+	if err != nil {
+		if deleteErr := rt.db.DeleteUpload(upload); deleteErr != nil {
+			return Photo{}, http.StatusInternalServerError, deleteErr
+		}
+		return Photo{}, http.StatusBadRequest, err
+	}
+
+	// Upload the photo and link the upload to it
+	quota, err := rt.getAppliedQuota(photo.OwnerId)
+	if err == nil {
+		photo, err = rt.db.FinishUpload(upload, photo, quota, parseMentions(photo.Caption))
+	}
+	if err != nil {
+		if releaseErr := rt.db.ReleaseUpload(upload.UploadId); releaseErr != nil {
+			return Photo{}, http.StatusInternalServerError, releaseErr
+		}
+		return Photo{}, http.StatusInternalServerError, err
+	}
+
+	return photo, http.StatusOK, nil
+}
+
+/*
+deleteUpload Delete a resumable upload, discarding the data received so far.
+Deleting a complete upload does not delete the photo created from it.
+
+	curl -X DELETE BASE_URL/users/USERNAME/uploads/UPLOAD_ID -H 'Authorization: Bearer USER_ID' -H 'Tus-Resumable: 1.0.0'
+*/
+func (rt *_router) deleteUpload(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the protocol version
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	// Get the upload's data from the db
+	upload, ok := rt.getRequesterUpload(w, ps, header)
+	if !ok {
+		return
+	}
+
+	// Delete the upload
+	err = rt.db.DeleteUpload(upload)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success
+	w.WriteHeader(http.StatusNoContent)
+}
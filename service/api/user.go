@@ -8,72 +8,116 @@ import (
 	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"net/url"
 	"strconv"
 )
 
-// maxPageSize is the maximum number of users that can be retrieved in a single request.
-const maxPageSize = 100
+// defaultMutualFollowers is the number of mutual followers returned with a profile when none is given.
+const defaultMutualFollowers = 3
 
-/*
-getAllUsers retrieves all users from the database via paginated requests.
+// maxMutualFollowers is the maximum number of mutual followers returned with a profile.
+const maxMutualFollowers = 20
 
-	curl -X GET BASE_URL/users?page=1&pageSize=50 -H 'Authorization Bearer USER_ID'
-*/
-func (rt *_router) getAllUsers(w http.ResponseWriter, r *http.Request, _ httprouter.Params, _ reqcontext.RequestContext) {
-	pageStr := r.URL.Query().Get("page")
-	pageSizeStr := r.URL.Query().Get("pageSize")
+// parseMutualsLimit is a helper function to get the number of mutual followers to return from the `mutuals` query parameter.
+func parseMutualsLimit(query url.Values) (int, error) {
+	if query.Get("mutuals") == "" {
+		return defaultMutualFollowers, nil
+	}
+	limit, err := strconv.Atoi(query.Get("mutuals"))
+	if err != nil || limit < 0 || limit > maxMutualFollowers {
+		return 0, fmt.Errorf("mutuals must be an integer between 0 and %d", maxMutualFollowers)
+	}
+	return limit, nil
+}
 
-	var page, pageSize int
-	var err error
+// errUnauthorized is returned by parseUserSearch when the search requires the auth header and it is missing or invalid.
+var errUnauthorized = errors.New("the auth header is required")
 
-	// Validate the page number
-	if pageStr == "" {
-		page = 1 // Default value
-	} else {
-		page, err = strconv.Atoi(pageStr)
-		if err != nil {
-			respondWithJSONError(w, "Page number must be a valid integer", http.StatusBadRequest)
-			return
+/*
+parseUserSearch is a helper function to get the search of a list of users from the query parameters.
+Only the users followed by the requester are listed if `following` is true, which requires the auth header.
+*/
+func parseUserSearch(r *http.Request) (UserSearch, error) {
+	query := r.URL.Query()
+	search := UserSearch{Query: query.Get("q"), Sort: UserSortJoined}
+
+	// Validate the searched text, which can only match a username if it could be part of one
+	if search.Query != "" {
+		if err := validateString(userSearchPattern, search.Query); err != nil {
+			return search, err
 		}
 	}
-	if page < 1 {
-		respondWithJSONError(w, "page number must be greater than 0", http.StatusBadRequest)
-		return
+	switch query.Get("match") {
+	case "", "prefix":
+	case "substring":
+		search.Substring = true
+	default:
+		return search, errors.New("match must be either prefix or substring")
 	}
 
-	// Validate the page size
-	if pageSizeStr == "" {
-		pageSize = 50 // Default value
-	} else {
-		pageSize, err = strconv.Atoi(pageSizeStr)
+	switch query.Get("sort") {
+	case "", UserSortJoined:
+	case UserSortFollowers, UserSortPhotos:
+		search.Sort = query.Get("sort")
+	default:
+		return search, fmt.Errorf("sort must be one of %s, %s or %s", UserSortJoined, UserSortFollowers, UserSortPhotos)
+	}
+
+	if query.Get("following") != "" {
+		following, err := strconv.ParseBool(query.Get("following"))
 		if err != nil {
-			respondWithJSONError(w, "Page size must be a valid integer", http.StatusBadRequest)
-			return
+			return search, errors.New("following must be a boolean")
+		}
+		if following {
+			header, err := parseAuthHeader(r.Header.Get("Authorization"))
+			if err != nil {
+				return search, fmt.Errorf("%w: %v", errUnauthorized, err)
+			}
+			search.FollowedBy = header
 		}
 	}
-	if pageSize < 1 || pageSize > maxPageSize {
-		respondWithJSONError(w, fmt.Sprintf("page size must be between 1 and %d", maxPageSize), http.StatusBadRequest)
+
+	return search, nil
+}
+
+/*
+getAllUsers retrieves the users from the database via paginated requests.
+They can be searched by username, sorted by join date, followers or photos, and restricted to the followed ones.
+
+	curl -X GET 'BASE_URL/users?q=TEXT&match=prefix&sort=followers&following=true&cursor=CURSOR&limit=50' -H 'Authorization Bearer USER_ID'
+*/
+func (rt *_router) getAllUsers(w http.ResponseWriter, r *http.Request, _ httprouter.Params, _ reqcontext.RequestContext) {
+	// Validate the search
+	search, err := parseUserSearch(r)
+	if errors.Is(err, errUnauthorized) {
+		respondWithJSONError(w, err.Error(), http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	users, err := rt.db.GetAllUsers(page, pageSize)
+	// Validate the requested page
+	cursor, limit, err := parsePage(r.URL.Query())
 	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(users)
+	users, nextCursor, err := rt.db.GetAllUsers(search, cursor, limit)
 	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		respondWithPageError(w, err)
 		return
 	}
+
+	respondWithPage(w, users, nextCursor)
 }
 
 /*
 getUserProfile Given a user's username, retrieve all the public info available.
+For the other users, it includes the relationship between them and the requester, with some mutual followers.
 
-	curl -X GET BASE_URL/users/USERNAME/profile -H 'Authorization: Bearer USER_ID'
+	curl -X GET BASE_URL/users/USERNAME/profile?mutuals=N -H 'Authorization: Bearer USER_ID'
 */
 func (rt *_router) getUserProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
 	var user User
@@ -106,6 +150,13 @@ func (rt *_router) getUserProfile(w http.ResponseWriter, r *http.Request, ps htt
 		return
 	}
 
+	// Validate the number of mutual followers
+	mutualsLimit, err := parseMutualsLimit(r.URL.Query())
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	profile.UserId = user.UserId
 	profile.Username = user.Username
 
@@ -138,6 +189,24 @@ func (rt *_router) getUserProfile(w http.ResponseWriter, r *http.Request, ps htt
 	}
 	profile.BannedCount = bannedCount
 
+	// Show the storage usage to the user themselves
+	if user.UserId == header {
+		usage, err := rt.getStorageUsage(user.UserId)
+		if err != nil {
+			respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		profile.Usage = &usage
+	} else {
+		// Show the relationship to the other users
+		relationship, err := rt.db.GetRelationship(header, user.UserId, mutualsLimit)
+		if err != nil {
+			respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		profile.Relationship = &relationship
+	}
+
 	// Return the profile schema as response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -153,7 +222,7 @@ getMyStream Given a user's id, retrieve the content stream.
 The stream is composed of Photo entries.
 These entries are sorted in reverse chronological order.
 
-	curl -X GET BASE_URL/stream -H 'Authorization: Bearer USER_ID'
+	curl -X GET 'BASE_URL/stream?cursor=CURSOR&limit=LIMIT' -H 'Authorization: Bearer USER_ID'
 */
 func (rt *_router) getMyStream(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
 	var user User
@@ -166,21 +235,32 @@ func (rt *_router) getMyStream(w http.ResponseWriter, r *http.Request, ps httpro
 	}
 	user.UserId = header
 
+	// Validate the requested page
+	cursor, limit, err := parsePage(r.URL.Query())
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Get the stream
-	stream, err := rt.db.GetMyStream(user)
+	stream, nextCursor, err := rt.db.GetMyStream(user, cursor, limit)
 	if err != nil {
-		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		respondWithPageError(w, err)
 		return
 	}
 
-	// Return the stream as response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(stream)
+	// Apply the sensitive media setting of the requester
+	stream, err = rt.filterSensitive(header, stream)
 	if err != nil {
 		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	// Count the impressions of the photos, they are written to the db later
+	rt.recordViews(header, ViewImpression, stream)
+
+	// Return the stream as response
+	respondWithPage(w, stream, nextCursor)
 }
 
 /*
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/api/reqcontext"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/globaltime"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// viewWindow is the time window in which the views of a photo by the same viewer are counted once.
+const viewWindow = time.Hour
+
+// viewFlushInterval is how often the buffered views are written to the db.
+const viewFlushInterval = 10 * time.Second
+
+// maxPendingViews is the maximum number of views buffered between two flushes, the next ones are dropped.
+const maxPendingViews = 100000
+
+/*
+viewBuffer collects the views of the photos in memory, so that they are written to the db in batches by flushViews
+instead of slowing down the requests that record them. Duplicated views are merged while buffered.
+The views being written by a flush are kept in flushing until it ends, so that the stats can still count them.
+*/
+type viewBuffer struct {
+	mu       sync.Mutex
+	pending  map[PhotoView]struct{}
+	flushing map[PhotoView]struct{}
+	dropped  int
+}
+
+/*
+recordViews is a helper function to count the views of some photos by a viewer, the views of the owners are ignored.
+The views are only buffered, so it never blocks on the db.
+*/
+func (rt *_router) recordViews(viewerId uint, kind string, photos []Photo) {
+	windowStart := globaltime.Now().UTC().Truncate(viewWindow).Format(time.RFC3339)
+
+	rt.views.mu.Lock()
+	defer rt.views.mu.Unlock()
+
+	if rt.views.pending == nil {
+		rt.views.pending = make(map[PhotoView]struct{})
+	}
+	for _, photo := range photos {
+		if photo.OwnerId == viewerId {
+			continue
+		}
+		if len(rt.views.pending) >= maxPendingViews {
+			rt.views.dropped++
+			continue
+		}
+		rt.views.pending[PhotoView{PhotoId: photo.PhotoId, UserId: viewerId, Kind: kind, WindowStart: windowStart}] = struct{}{}
+	}
+}
+
+/*
+flushViews Write the buffered views to the db.
+If the write fails, the views are put back in the buffer to be written by the next flush, as long as there is room.
+*/
+func (rt *_router) flushViews() error {
+	rt.views.mu.Lock()
+	pending, dropped := rt.views.pending, rt.views.dropped
+	rt.views.pending, rt.views.flushing, rt.views.dropped = nil, pending, 0
+	rt.views.mu.Unlock()
+	defer func() {
+		rt.views.mu.Lock()
+		rt.views.flushing = nil
+		rt.views.mu.Unlock()
+	}()
+
+	if dropped > 0 {
+		rt.baseLogger.WithField("views", dropped).Warn("views dropped, the buffer was full")
+	}
+
+	views := make([]PhotoView, 0, len(pending))
+	for view := range pending {
+		views = append(views, view)
+	}
+	err := rt.db.RecordPhotoViews(views)
+	if err != nil {
+		rt.baseLogger.WithError(err).WithField("views", len(views)).Warn("views not written, they are kept for the next flush")
+		rt.restoreViews(pending)
+	}
+	return err
+}
+
+// restoreViews Put back in the buffer the views of a failed flush, dropping the ones that do not fit anymore.
+func (rt *_router) restoreViews(pending map[PhotoView]struct{}) {
+	rt.views.mu.Lock()
+	defer rt.views.mu.Unlock()
+
+	if rt.views.pending == nil {
+		rt.views.pending = make(map[PhotoView]struct{}, len(pending))
+	}
+	for view := range pending {
+		if _, ok := rt.views.pending[view]; ok {
+			continue
+		}
+		if len(rt.views.pending) >= maxPendingViews {
+			rt.views.dropped++
+			continue
+		}
+		rt.views.pending[view] = struct{}{}
+	}
+}
+
+// pendingViews returns the views of a photo that are buffered or being flushed, so not yet stored in the db.
+func (rt *_router) pendingViews(photoId uint) []PhotoView {
+	rt.views.mu.Lock()
+	defer rt.views.mu.Unlock()
+
+	views := make([]PhotoView, 0)
+	for _, buffer := range []map[PhotoView]struct{}{rt.views.pending, rt.views.flushing} {
+		for view := range buffer {
+			if view.PhotoId == photoId {
+				views = append(views, view)
+			}
+		}
+	}
+	return views
+}
+
+/*
+getPhotoStats Get the number of impressions and views of a photo, and how many unique users it reached.
+Only the owner of the photo can see them. The views not yet written to the db are counted as well.
+
+	curl -X GET BASE_URL/users/USERNAME/photos/PHOTO_ID/stats -H 'Authorization: Bearer USER_ID'
+*/
+func (rt *_router) getPhotoStats(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	// Get the requesters data from the auth header
+	header, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the photo's data from the db
+	photoIdUint64, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	photo, err := rt.db.GetPhoto(uint(photoIdUint64))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if photo.OwnerId != header {
+		respondWithJSONError(w, "only the owner of the photo can see its stats", http.StatusForbidden)
+		return
+	}
+
+	// Get the stats from the db, along with the buffered views which are left to the flush worker
+	stats, err := rt.db.GetPhotoStats(photo.PhotoId, rt.pendingViews(photo.PhotoId))
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the stats
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(stats)
+	if err != nil {
+		respondWithJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
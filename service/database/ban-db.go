@@ -6,46 +6,21 @@ import (
 	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
 )
 
-// GetBansList returns the list of banned users.
-func (db *appdbimpl) GetBansList(userId uint) ([]User, error) {
-	rows, err := db.c.Query(`
-        SELECT bannedUserId FROM Bans
-        WHERE userId = ?`,
-		userId,
-	)
-	if err != nil {
-		return nil, err
-	}
-	defer func() { _ = rows.Close() }()
-
-	var bannedIds []uint
-	for rows.Next() {
-		var bannedId uint
-		if err = rows.Scan(&bannedId); err != nil {
-			return nil, err
-		}
-		bannedIds = append(bannedIds, bannedId)
-	}
-
-	bannedUsers := make([]User, 0)
-	for _, bannedId := range bannedIds {
-		row := db.c.QueryRow(`
-            SELECT username FROM Users
-            WHERE userId = ?`,
-			bannedId,
-		)
-		var username string
-		if err = row.Scan(&username); err != nil {
-			return nil, err
-		}
-		bannedUsers = append(bannedUsers, User{UserId: bannedId, Username: username})
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
+// GetBansList returns a page of the list of banned users, sorted by id.
+func (db *appdbimpl) GetBansList(userId uint, cursor string, limit int) ([]User, string, error) {
+	var afterId uint
+	if err := decodeCursor(cursor, &afterId); err != nil {
+		return nil, "", err
 	}
 
-	return bannedUsers, nil
+	return db.queryUserPage(`
+        SELECT Users.userId, Users.username FROM Bans
+        INNER JOIN Users ON Users.userId = Bans.bannedUserId
+        WHERE Bans.userId = ? AND Bans.bannedUserId > ?
+        ORDER BY Bans.bannedUserId
+        LIMIT ?`,
+		limit, userId, afterId, limit+1,
+	)
 }
 
 // GetBansCount returns the number of banned users.
@@ -87,7 +62,9 @@ func (db *appdbimpl) GetBanStatus(userId uint, targetUserId uint) (bool, error)
 BanUser adds a user to the ban list.
 
 Also, breaks the follow relationship between the two users,
-deletes all comments and likes of the banned user from the requester's photos.
+deletes all comments and likes of the banned user from the requester's photos,
+all mentions of the requester made by the banned user, all tags between the two users,
+and all photos of the requester saved in the collections of the banned user.
 */
 func (db *appdbimpl) BanUser(userId uint, targetUserId uint) error {
 	// Ban the target user
@@ -124,6 +101,36 @@ func (db *appdbimpl) BanUser(userId uint, targetUserId uint) error {
 		return err
 	}
 
+	// Remove all reactions of the target user to the comments under the requester's photos, or by the requester
+	err = db.DeleteCommentReactionsByBannedUser(userId, targetUserId)
+	if err != nil {
+		return err
+	}
+
+	// Remove all mentions of the requester made by the target user
+	err = db.DeleteMentionsByBannedUser(userId, targetUserId)
+	if err != nil {
+		return err
+	}
+
+	// Remove all tags between the requester and the target user
+	err = db.DeleteTagsByBannedUser(userId, targetUserId)
+	if err != nil {
+		return err
+	}
+
+	// Remove all photos of the requester from the collections of the target user
+	err = db.DeleteCollectionItemsByBannedUser(userId, targetUserId)
+	if err != nil {
+		return err
+	}
+
+	// Remove the target user from the viewers of the requester's stories
+	err = db.DeleteStoryViewsByBannedUser(userId, targetUserId)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -141,25 +148,64 @@ func (db *appdbimpl) UnbanUser(userId uint, targetUserId uint) error {
 	return nil
 }
 
-// DeleteCommentsByBannedUser Remove all comments of a banned user from the photos of the requester.
+/*
+DeleteCommentsByBannedUser Remove all comments of a banned user from the photos of the requester.
+The replies of other users to those comments are kept, under their deleted parent.
+*/
 func (db *appdbimpl) DeleteCommentsByBannedUser(userId uint, bannedUserId uint) error {
-	_, err := db.c.Exec(`
-		DELETE FROM Comments
-		WHERE ownerId = ? AND photoId IN (
+	// Get the comments to delete, newest first so that the replies are deleted before their parents
+	rows, err := db.c.Query(`
+		SELECT commentId FROM Comments
+		WHERE ownerId = ? AND deleted = 0 AND photoId IN (
 			SELECT photoId FROM Photos WHERE ownerId = ?
-		)`,
+		)
+		ORDER BY commentId DESC`,
 		bannedUserId, userId,
 	)
 	if err != nil {
 		return err
 	}
+	defer func() { _ = rows.Close() }()
+
+	var commentIds []uint
+	for rows.Next() {
+		var commentId uint
+		if err = rows.Scan(&commentId); err != nil {
+			return err
+		}
+		commentIds = append(commentIds, commentId)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	_ = rows.Close()
+
+	// Delete the comments, along with their mentions
+	for _, commentId := range commentIds {
+		if err = db.deleteComment(commentId); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-// DeleteLikesByBannedUser Remove all likes of a banned user from the photos of the requester.
+// DeleteLikesByBannedUser Remove all likes and reactions of a banned user from the photos of the requester.
 func (db *appdbimpl) DeleteLikesByBannedUser(userId uint, bannedUserId uint) error {
+	// Decrement the LikeCount field of the photos first, while the likes still exist
 	_, err := db.c.Exec(`
+        UPDATE Photos
+        SET likeCount = likeCount - 1
+        WHERE ownerId = ? AND photoId IN (
+            SELECT photoId FROM Likes WHERE userId = ?
+        )`,
+		userId, bannedUserId,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.c.Exec(`
         DELETE FROM Likes
         WHERE userId = ? AND photoId IN (
             SELECT photoId FROM Photos WHERE ownerId = ?
@@ -0,0 +1,260 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/globaltime"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"strings"
+	"time"
+)
+
+/*
+collectionColumns is the list of columns selected whenever a Collection is read from the database.
+The photo count only includes the photos still visible to the owner of the collection, as in photoVisibleTo.
+*/
+const collectionColumns = `Collections.collectionId, Collections.ownerId, Collections.name, Collections.createdAt, (
+	SELECT COUNT(*) FROM CollectionItems
+	INNER JOIN Photos ON CollectionItems.photoId = Photos.photoId
+	WHERE CollectionItems.collectionId = Collections.collectionId
+	AND ` + photoPublished + ` AND Photos.ownerId NOT IN (SELECT userId FROM Bans WHERE bannedUserId = Collections.ownerId)
+)`
+
+// GetCollections Get all collections of a user, sorted by name.
+func (db *appdbimpl) GetCollections(ownerId uint) ([]Collection, error) {
+	rows, err := db.c.Query(`
+        SELECT `+collectionColumns+`
+        FROM Collections
+        WHERE ownerId = ?
+        ORDER BY name`,
+		ownerId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	collections := make([]Collection, 0)
+	for rows.Next() {
+		var collection Collection
+		if err = rows.Scan(
+			&collection.CollectionId,
+			&collection.OwnerId,
+			&collection.Name,
+			&collection.CreatedAt,
+			&collection.PhotoCount,
+		); err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
+
+/*
+GetCollection Get a collection by its id.
+Collections are private, so it is only found if it belongs to the user with id `ownerId`.
+*/
+func (db *appdbimpl) GetCollection(collectionId uint, ownerId uint) (Collection, error) {
+	var collection Collection
+	if err := db.c.QueryRow(`
+        SELECT `+collectionColumns+`
+        FROM Collections
+        WHERE collectionId = ? AND ownerId = ?`,
+		collectionId, ownerId,
+	).Scan(
+		&collection.CollectionId,
+		&collection.OwnerId,
+		&collection.Name,
+		&collection.CreatedAt,
+		&collection.PhotoCount,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Collection{}, &CollectionNotFoundError{CollectionId: collectionId}
+		}
+		return Collection{}, err
+	}
+	return collection, nil
+}
+
+// CreateCollection Create a new empty collection.
+func (db *appdbimpl) CreateCollection(collection Collection) (Collection, error) {
+	createdAt := globaltime.Now().UTC().Format(time.RFC3339)
+
+	res, err := db.c.Exec(`
+        INSERT INTO Collections (ownerId, name, createdAt)
+        VALUES (?, ?, ?)`,
+		collection.OwnerId, collection.Name, createdAt,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return Collection{}, &CollectionNameTakenError{Name: collection.Name}
+		}
+		return Collection{}, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Collection{}, err
+	}
+
+	collection.CollectionId = uint(id)
+	collection.CreatedAt = createdAt
+	collection.PhotoCount = 0
+	return collection, nil
+}
+
+// RenameCollection Change the name of a collection.
+func (db *appdbimpl) RenameCollection(collection Collection) (Collection, error) {
+	_, err := db.c.Exec(`
+        UPDATE Collections
+        SET name = ?
+        WHERE collectionId = ? AND ownerId = ?`,
+		collection.Name, collection.CollectionId, collection.OwnerId,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return Collection{}, &CollectionNameTakenError{Name: collection.Name}
+		}
+		return Collection{}, err
+	}
+
+	return db.GetCollection(collection.CollectionId, collection.OwnerId)
+}
+
+// DeleteCollection Delete a collection and the list of photos saved in it.
+func (db *appdbimpl) DeleteCollection(collection Collection) error {
+	// Delete the items of the collection
+	_, err := db.c.Exec(`
+        DELETE FROM CollectionItems
+        WHERE collectionId IN (
+            SELECT collectionId FROM Collections WHERE collectionId = ? AND ownerId = ?
+        )`,
+		collection.CollectionId, collection.OwnerId,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Delete the collection
+	_, err = db.c.Exec(`
+        DELETE FROM Collections
+        WHERE collectionId = ? AND ownerId = ?`,
+		collection.CollectionId, collection.OwnerId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+/*
+GetCollectionPhotos Get the list of photos saved in a collection.
+Photos hidden from the owner of the collection by a ban are not returned.
+The photos are sorted by their position in the collection.
+*/
+func (db *appdbimpl) GetCollectionPhotos(collection Collection) ([]Photo, error) {
+	return db.queryPhotos(
+		`SELECT `+photoColumns+`
+		FROM CollectionItems
+		INNER JOIN Photos ON CollectionItems.photoId = Photos.photoId
+		INNER JOIN Users ON Photos.ownerId = Users.userId
+		WHERE CollectionItems.collectionId = ? AND `+photoVisibleTo+`
+		ORDER BY CollectionItems.position, CollectionItems.photoId`,
+		collection.CollectionId, collection.OwnerId,
+	)
+}
+
+/*
+AddToCollection Save a photo at the end of a collection.
+Saving a photo already in the collection does nothing.
+*/
+func (db *appdbimpl) AddToCollection(collectionId uint, photoId uint) error {
+	_, err := db.c.Exec(`
+        INSERT OR IGNORE INTO CollectionItems (collectionId, photoId, position)
+        SELECT ?, ?, COALESCE(MAX(position) + 1, 0) FROM CollectionItems
+        WHERE collectionId = ?`,
+		collectionId, photoId, collectionId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RemoveFromCollection Remove a photo from a collection.
+func (db *appdbimpl) RemoveFromCollection(collectionId uint, photoId uint) error {
+	_, err := db.c.Exec(`
+        DELETE FROM CollectionItems
+        WHERE collectionId = ? AND photoId = ?`,
+		collectionId, photoId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+/*
+ReorderCollection Move the given photos of a collection to the top, in the given order.
+The photos of the collection not in the list keep their relative order, after the given ones.
+*/
+func (db *appdbimpl) ReorderCollection(collectionId uint, photoIds []uint) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Shift all the items down, making room for the given ones at the top
+	_, err = tx.Exec(`
+        UPDATE CollectionItems
+        SET position = position + ?
+        WHERE collectionId = ?`,
+		len(photoIds), collectionId,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Place the given items at the top
+	for position, photoId := range photoIds {
+		_, err = tx.Exec(`
+            UPDATE CollectionItems
+            SET position = ?
+            WHERE collectionId = ? AND photoId = ?`,
+			position, collectionId, photoId,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteCollectionItemsByBannedUser Remove all photos of the requester from the collections of a banned user.
+func (db *appdbimpl) DeleteCollectionItemsByBannedUser(userId uint, bannedUserId uint) error {
+	_, err := db.c.Exec(`
+        DELETE FROM CollectionItems
+        WHERE photoId IN (
+            SELECT photoId FROM Photos WHERE ownerId = ?
+        ) AND collectionId IN (
+            SELECT collectionId FROM Collections WHERE ownerId = ?
+        )`,
+		userId, bannedUserId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -1,14 +1,132 @@
 package database
 
-import . "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/globaltime"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"time"
+)
 
-// GetPhotoComments Get all comments under a photo.
-func (db *appdbimpl) GetPhotoComments(photoId uint) ([]Comment, error) {
-	rows, err := db.c.Query(`
-		SELECT Comments.commentId, Comments.ownerId, Users.username, Comments.content
+/*
+commentColumns is the list of columns selected whenever a Comment is read from the database.
+The order of the columns must match the one expected by scanComment.
+*/
+const commentColumns = `Comments.commentId, Comments.ownerId, Users.username, Comments.photoId, Comments.content, Comments.createdAt, Comments.editedAt,
+	Comments.pinnedAt, Comments.parentCommentId, Comments.deleted, Comments.approved`
+
+// scanComment scans a row selected via commentColumns into a Comment, hiding the owner of the deleted ones.
+func scanComment(row rowScanner) (Comment, error) {
+	var comment Comment
+	err := row.Scan(
+		&comment.CommentId,
+		&comment.OwnerId,
+		&comment.OwnerUsername,
+		&comment.PhotoId,
+		&comment.Content,
+		&comment.CreatedAt,
+		&comment.EditedAt,
+		&comment.PinnedAt,
+		&comment.ParentCommentId,
+		&comment.Deleted,
+		&comment.Approved,
+	)
+	if comment.Deleted {
+		comment.OwnerId = 0
+		comment.OwnerUsername = ""
+		comment.EditedAt = nil
+	}
+	return comment, err
+}
+
+// commentOrder is the order of the comments: the pinned ones first, in the order they were pinned, then the others.
+const commentOrder = `Comments.pinnedAt IS NULL, Comments.pinnedAt, Comments.createdAt, Comments.commentId`
+
+/*
+GetPhotoComments Get a page of the top level comments under a photo, along with their replies up to depth levels
+below, as seen by a viewer.
+The pinned comments come first, in the order they were pinned, then the others from oldest to newest.
+The comments posted before their creation time was recorded come first, in the order they were posted.
+The replies follow the top level comments, in the same order.
+*/
+func (db *appdbimpl) GetPhotoComments(photoId uint, viewerId uint, cursor string, limit int, depth int) ([]Comment, string, error) {
+	var unpinned bool
+	var pinnedAt, createdAt string
+	var afterId uint
+	if err := decodeCursor(cursor, &unpinned, &pinnedAt, &createdAt, &afterId); err != nil {
+		return nil, "", err
+	}
+
+	comments, err := db.queryComments(`
+		SELECT `+commentColumns+`
 		FROM Comments
 		INNER JOIN Users ON Comments.ownerId = Users.userId
-		WHERE Comments.photoId = ?`, photoId)
+		WHERE Comments.photoId = ? AND Comments.parentCommentId IS NULL
+			AND (Comments.pinnedAt IS NULL, COALESCE(Comments.pinnedAt, ''), Comments.createdAt, Comments.commentId) > (?, ?, ?, ?)
+		ORDER BY `+commentOrder+`
+		LIMIT ?`,
+		photoId, unpinned, pinnedAt, createdAt, afterId, limit+1,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(comments) > limit {
+		comments = comments[:limit]
+		last := comments[limit-1]
+		lastPinnedAt := ""
+		if last.PinnedAt != nil {
+			lastPinnedAt = *last.PinnedAt
+		}
+		nextCursor = encodeCursor(last.PinnedAt == nil, lastPinnedAt, last.CreatedAt, last.CommentId)
+	}
+
+	// Add the replies to the top level comments, and the reactions to every comment
+	replies, err := db.queryReplies(commentIds(comments), depth)
+	if err != nil {
+		return nil, "", err
+	}
+	comments = append(comments, replies...)
+	err = db.addCommentReactions(comments, viewerId, `commentId IN (SELECT value FROM json_each(?))`, commentIds(comments))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return comments, nextCursor, nil
+}
+
+/*
+GetCommentReplies Get the replies to a comment, including the replies to the replies up to depth levels below the
+comment, as seen by a viewer.
+*/
+func (db *appdbimpl) GetCommentReplies(commentId uint, viewerId uint, depth int) ([]Comment, error) {
+	replies, err := db.queryReplies(fmt.Sprintf("[%d]", commentId), depth)
+	if err != nil {
+		return nil, err
+	}
+	err = db.addCommentReactions(replies, viewerId, `commentId IN (SELECT value FROM json_each(?))`, commentIds(replies))
+	if err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
+
+// commentIds returns the ids of the given comments as a JSON array, to be read via json_each.
+func commentIds(comments []Comment) string {
+	ids := make([]uint, 0, len(comments))
+	for _, comment := range comments {
+		ids = append(ids, comment.CommentId)
+	}
+	data, _ := json.Marshal(ids)
+	return string(data)
+}
+
+// queryComments runs a query selecting commentColumns and returns the resulting list of comments.
+func (db *appdbimpl) queryComments(query string, args ...interface{}) ([]Comment, error) {
+	rows, err := db.c.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -16,12 +134,10 @@ func (db *appdbimpl) GetPhotoComments(photoId uint) ([]Comment, error) {
 
 	comments := make([]Comment, 0)
 	for rows.Next() {
-		var comment Comment
-		err = rows.Scan(&comment.CommentId, &comment.OwnerId, &comment.OwnerUsername, &comment.Content)
+		comment, err := scanComment(rows)
 		if err != nil {
 			return nil, err
 		}
-
 		comments = append(comments, comment)
 	}
 
@@ -32,12 +148,64 @@ func (db *appdbimpl) GetPhotoComments(photoId uint) ([]Comment, error) {
 	return comments, nil
 }
 
-// CommentPhoto Add a comment under a photo.
+/*
+queryReplies returns the replies to the comments with the given ids, as a JSON array, including the replies to the
+replies up to depth levels below them, sorted by commentOrder. The direct replies are the first level, so no reply is
+returned for a depth of 0.
+*/
+func (db *appdbimpl) queryReplies(parentIds string, depth int) ([]Comment, error) {
+	return db.queryComments(`
+		WITH RECURSIVE Thread(commentId, depth) AS (
+			SELECT commentId, 1 FROM Comments
+			WHERE parentCommentId IN (SELECT value FROM json_each(?)) AND ? >= 1
+			UNION ALL
+			SELECT Comments.commentId, Thread.depth + 1 FROM Comments
+			INNER JOIN Thread ON Comments.parentCommentId = Thread.commentId
+			WHERE Thread.depth < ?
+		)
+		SELECT `+commentColumns+`
+		FROM Comments
+		INNER JOIN Users ON Comments.ownerId = Users.userId
+		WHERE Comments.commentId IN (SELECT commentId FROM Thread)
+		ORDER BY `+commentOrder,
+		parentIds, depth, depth,
+	)
+}
+
+// GetComment Get a comment under a photo, as seen by a viewer.
+func (db *appdbimpl) GetComment(photoId uint, commentId uint, viewerId uint) (Comment, error) {
+	comment, err := scanComment(db.c.QueryRow(`
+		SELECT `+commentColumns+`
+		FROM Comments
+		INNER JOIN Users ON Comments.ownerId = Users.userId
+		WHERE Comments.commentId = ? AND Comments.photoId = ?`,
+		commentId, photoId,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Comment{}, &CommentNotFoundError{CommentId: commentId}
+		}
+		return Comment{}, err
+	}
+
+	comments := []Comment{comment}
+	if err = db.addCommentReactions(comments, viewerId, `commentId = ?`, commentId); err != nil {
+		return Comment{}, err
+	}
+	return comments[0], nil
+}
+
+// CommentPhoto Add a comment under a photo, or a reply to another comment if its ParentCommentId is set.
 func (db *appdbimpl) CommentPhoto(photoId uint, comment Comment) (Comment, error) {
+	comment.CreatedAt = globaltime.Now().UTC().Format(time.RFC3339)
+	comment.EditedAt = nil
+	comment.Reactions = make(map[string]uint)
+	comment.MyReaction = ""
+
 	res, err := db.c.Exec(`
-        INSERT INTO Comments (ownerId, photoId, content)
-        VALUES (?, ?, ?)`,
-		comment.OwnerId, photoId, comment.Content,
+        INSERT INTO Comments (ownerId, photoId, content, parentCommentId, createdAt)
+        VALUES (?, ?, ?, ?, ?)`,
+		comment.OwnerId, photoId, comment.Content, comment.ParentCommentId, comment.CreatedAt,
 	)
 	if err != nil {
 		return Comment{}, err
@@ -60,27 +228,89 @@ func (db *appdbimpl) CommentPhoto(photoId uint, comment Comment) (Comment, error
 	}
 
 	comment.CommentId = uint(id)
+	comment.PhotoId = photoId
 	return comment, nil
 }
 
 // UncommentPhoto Remove a comment from a photo.
 func (db *appdbimpl) UncommentPhoto(photoId uint, comment Comment) error {
-	// Delete the comment
-	_, err := db.c.Exec(`
-        DELETE FROM Comments
-        WHERE commentId = ? AND ownerId = ? AND photoId = ?`,
+	// Check that the comment exists and belongs to the user, nothing is removed otherwise
+	err := db.c.QueryRow(`
+        SELECT commentId FROM Comments
+        WHERE commentId = ? AND ownerId = ? AND photoId = ? AND deleted = 0`,
 		comment.CommentId, comment.OwnerId, photoId,
+	).Scan(&comment.CommentId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return db.deleteComment(comment.CommentId)
+}
+
+// DeleteComment Remove any comment from a photo, regardless of its owner.
+func (db *appdbimpl) DeleteComment(photoId uint, commentId uint) error {
+	// Check that the comment exists under the photo, nothing is removed otherwise
+	err := db.c.QueryRow(`
+        SELECT commentId FROM Comments
+        WHERE commentId = ? AND photoId = ? AND deleted = 0`,
+		commentId, photoId,
+	).Scan(&commentId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return db.deleteComment(commentId)
+}
+
+/*
+PinComment Pin a comment to the top of the comments of a photo, unless maxPinned comments are already pinned.
+It returns false if the comment was not pinned, because of the limit or because it is already pinned.
+*/
+func (db *appdbimpl) PinComment(photoId uint, commentId uint, maxPinned int) (bool, error) {
+	res, err := db.c.Exec(`
+        UPDATE Comments
+        SET pinnedAt = ?
+        WHERE commentId = ? AND photoId = ? AND pinnedAt IS NULL AND deleted = 0
+        AND (SELECT COUNT(*) FROM Comments WHERE photoId = ? AND pinnedAt IS NOT NULL) < ?`,
+		globaltime.Now().UTC().Format(time.RFC3339), commentId, photoId, photoId, maxPinned,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	pinned, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return pinned > 0, nil
+}
+
+// UnpinComment Unpin a comment from the top of the comments of a photo.
+func (db *appdbimpl) UnpinComment(photoId uint, commentId uint) error {
+	_, err := db.c.Exec(`
+        UPDATE Comments
+        SET pinnedAt = NULL
+        WHERE commentId = ? AND photoId = ?`,
+		commentId, photoId,
 	)
 	if err != nil {
 		return err
 	}
 
-	// Decrement the CommentsCount field of the photo
-	_, err = db.c.Exec(`
+	return nil
+}
+
+// SetCommentsLocked Turn off, or back on, new comments on a photo.
+func (db *appdbimpl) SetCommentsLocked(photoId uint, locked bool) error {
+	_, err := db.c.Exec(`
         UPDATE Photos
-        SET commentsCount = commentsCount - 1
-        WHERE PhotoId = ?`,
-		photoId,
+        SET commentsLocked = ?
+        WHERE photoId = ?`,
+		locked, photoId,
 	)
 	if err != nil {
 		return err
@@ -88,3 +318,215 @@ func (db *appdbimpl) UncommentPhoto(photoId uint, comment Comment) error {
 
 	return nil
 }
+
+/*
+EditComment Replace the content of a comment under a photo, keeping the previous one in its history.
+The mentions made in the previous content are replaced by the ones of the given usernames, as in AddMentions.
+The approval of the comment by the owner of the photo is revoked, as it applied to the previous content.
+Deleted comments cannot be edited.
+*/
+func (db *appdbimpl) EditComment(photoId uint, commentId uint, content string, mentions []string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var previous, writtenAt string
+	var editedAt *string
+	var authorId uint
+	err = tx.QueryRow(`
+        SELECT content, createdAt, editedAt, ownerId FROM Comments
+        WHERE commentId = ? AND photoId = ? AND deleted = 0`,
+		commentId, photoId,
+	).Scan(&previous, &writtenAt, &editedAt, &authorId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &CommentNotFoundError{CommentId: commentId}
+	} else if err != nil {
+		return err
+	}
+	if editedAt != nil {
+		writtenAt = *editedAt
+	}
+
+	if content != previous {
+		now := globaltime.Now().UTC().Format(time.RFC3339)
+
+		// Keep the previous version of the comment
+		_, err = tx.Exec(`
+            INSERT INTO CommentVersions (commentId, content, writtenAt, replacedAt)
+            VALUES (?, ?, ?, ?)`,
+			commentId, previous, writtenAt, now,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+            UPDATE Comments
+            SET content = ?, editedAt = ?, approved = 0
+            WHERE commentId = ?`,
+			content, now, commentId,
+		)
+		if err != nil {
+			return err
+		}
+
+		// Replace the mentions made in the previous version
+		_, err = tx.Exec(`
+            DELETE FROM Mentions
+            WHERE commentId = ? AND photoId = ?`,
+			commentId, photoId,
+		)
+		if err != nil {
+			return err
+		}
+		if err = addMentions(tx, photoId, commentId, authorId, mentions); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetCommentVersions Get the previous versions of an edited comment, from oldest to newest.
+func (db *appdbimpl) GetCommentVersions(commentId uint) ([]CommentVersion, error) {
+	rows, err := db.c.Query(`
+        SELECT content, writtenAt, replacedAt
+        FROM CommentVersions
+        WHERE commentId = ?
+        ORDER BY versionId`,
+		commentId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	versions := make([]CommentVersion, 0)
+	for rows.Next() {
+		var version CommentVersion
+		if err = rows.Scan(&version.Content, &version.WrittenAt, &version.ReplacedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+/*
+deleteComment Delete a comment, keeping the threads of replies intact.
+A comment with replies is only marked as deleted, clearing its content, so that its replies keep their parent.
+A comment without replies is removed, along with its parent if the latter was deleted and has no other replies.
+*/
+func (db *appdbimpl) deleteComment(commentId uint) error {
+	var photoId uint
+	var parentCommentId *uint
+	var deleted bool
+	err := db.c.QueryRow(`
+        SELECT photoId, parentCommentId, deleted FROM Comments
+        WHERE commentId = ?`,
+		commentId,
+	).Scan(&photoId, &parentCommentId, &deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Delete the mentions made in the comment
+	_, err = db.c.Exec(`
+        DELETE FROM Mentions
+        WHERE commentId = ? AND photoId = ?`,
+		commentId, photoId,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Delete the reactions to the comment
+	_, err = db.c.Exec(`
+        DELETE FROM CommentReactions
+        WHERE commentId = ?`,
+		commentId,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Delete the previous versions of the comment, its content is gone in both cases below
+	_, err = db.c.Exec(`
+        DELETE FROM CommentVersions
+        WHERE commentId = ?`,
+		commentId,
+	)
+	if err != nil {
+		return err
+	}
+
+	var replies int
+	if err = db.c.QueryRow(`
+        SELECT COUNT(*) FROM Comments
+        WHERE parentCommentId = ?`,
+		commentId,
+	).Scan(&replies); err != nil {
+		return err
+	}
+
+	if replies > 0 {
+		// Keep the comment as the parent of its replies
+		_, err = db.c.Exec(`
+            UPDATE Comments
+            SET content = '', editedAt = NULL, pinnedAt = NULL, deleted = 1
+            WHERE commentId = ?`,
+			commentId,
+		)
+	} else {
+		_, err = db.c.Exec(`
+            DELETE FROM Comments
+            WHERE commentId = ?`,
+			commentId,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Decrement the CommentsCount field of the photo, deleted comments were already not counted
+	if !deleted {
+		_, err = db.c.Exec(`
+            UPDATE Photos
+            SET commentsCount = commentsCount - 1
+            WHERE PhotoId = ?`,
+			photoId,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Remove the parent too, if it was only kept for this reply
+	if replies == 0 && parentCommentId != nil {
+		var parentDeleted bool
+		err = db.c.QueryRow(`
+            SELECT deleted FROM Comments
+            WHERE commentId = ?`,
+			*parentCommentId,
+		).Scan(&parentDeleted)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if parentDeleted {
+			return db.deleteComment(*parentCommentId)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+)
+
+/*
+encodeCursor encodes the sort keys of the last element of a page of a list into an opaque cursor.
+The next page starts right after the element with those keys.
+*/
+func encodeCursor(keys ...interface{}) string {
+	data, _ := json.Marshal(keys)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+/*
+decodeCursor decodes a cursor made by encodeCursor into the given pointers to the sort keys.
+An empty cursor, requesting the first page, leaves the keys unchanged.
+If the cursor is malformed, or has a different number or type of keys, it returns an InvalidCursorError.
+*/
+func decodeCursor(cursor string, keys ...interface{}) error {
+	if cursor == "" {
+		return nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return &InvalidCursorError{Cursor: cursor}
+	}
+
+	var values []json.RawMessage
+	if err = json.Unmarshal(data, &values); err != nil || len(values) != len(keys) {
+		return &InvalidCursorError{Cursor: cursor}
+	}
+	for i := range keys {
+		if err = json.Unmarshal(values[i], keys[i]); err != nil {
+			return &InvalidCursorError{Cursor: cursor}
+		}
+	}
+
+	return nil
+}
+
+/*
+queryUserPage runs a query selecting the userId and username of up to limit+1 users, sorted by userId.
+It returns the first `limit` of them, and the cursor to the next page if there is one.
+*/
+func (db *appdbimpl) queryUserPage(query string, limit int, args ...interface{}) ([]User, string, error) {
+	rows, err := db.c.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = rows.Close() }()
+
+	users := make([]User, 0)
+	for rows.Next() {
+		var user User
+		if err = rows.Scan(&user.UserId, &user.Username); err != nil {
+			return nil, "", err
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(users) > limit {
+		users = users[:limit]
+		nextCursor = encodeCursor(users[limit-1].UserId)
+	}
+	return users, nextCursor, nil
+}
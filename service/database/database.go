@@ -34,7 +34,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/geo"
 	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"time"
 )
 
 // AppDatabase is the high level interface for the DB
@@ -42,14 +44,14 @@ type AppDatabase interface {
 	// user-db methods
 
 	CreateUser(user User) (User, error)
-	GetAllUsers(page int, pageSize int) ([]User, error)
+	GetAllUsers(search UserSearch, cursor string, limit int) ([]User, string, error)
 	GetUserProfile(user User) (User, error)
-	GetMyStream(user User) ([]Photo, error)
+	GetMyStream(user User, cursor string, limit int) ([]Photo, string, error)
 	SetMyUsername(user User, currentUsername string) (User, error)
 
 	// ban-db methods
 
-	GetBansList(userId uint) ([]User, error)
+	GetBansList(userId uint, cursor string, limit int) ([]User, string, error)
 	GetBansCount(userId uint) (uint, error)
 	GetBanStatus(userId uint, targetUserId uint) (bool, error)
 	BanUser(userId uint, targetUserId uint) error
@@ -59,33 +61,136 @@ type AppDatabase interface {
 
 	// follow-db methods
 
-	GetFollowersList(userId uint) ([]User, error)
+	GetFollowersList(userId uint, cursor string, limit int) ([]User, string, error)
 	GetFollowersCount(userId uint) (uint, error)
-	GetFollowingList(userId uint) ([]User, error)
+	GetFollowingList(userId uint, cursor string, limit int) ([]User, string, error)
 	GetFollowingCount(userId uint) (uint, error)
 	GetFollowStatus(userId uint, targetUserId uint) (bool, error)
 	FollowUser(userId uint, targetUserId uint) error
 	UnfollowUser(userId uint, targetUserId uint) error
+	GetSuggestions(userId uint, limit int) ([]Suggestion, error)
+	GetRelationship(userId uint, targetUserId uint, mutualsLimit int) (Relationship, error)
 
 	// photo-db methods
 
 	GetPhoto(photoId uint) (Photo, error)
-	GetPhotoList(userId uint) ([]Photo, error)
+	GetVisiblePhoto(photoId uint, viewerId uint) (Photo, error)
+	GetPhotoList(userId uint, cursor string, limit int) ([]Photo, string, error)
 	GetPhotoCount(userId uint) (uint, error)
-	UploadPhoto(photo Photo) (Photo, error)
+	UploadPhoto(photo Photo, quota Quota, mentions []string) (Photo, error)
 	DeletePhoto(photo Photo) error
+	GetPhotosInArea(box geo.Box, viewerId uint, limit uint) ([]Photo, error)
+	GetPhotosNearby(center geo.Point, radius float64, viewerId uint, limit uint) ([]Photo, error)
+	GetArchivedPhotos(userId uint) ([]Photo, error)
+	SetPhotoArchived(photoId uint, archived bool) error
+	GetScheduledPhotos(userId uint) ([]Photo, error)
+	PublishDuePhotos(now time.Time) ([]Photo, error)
+	SetPhotoAltText(photoId uint, altText string) error
+	SearchPhotos(query string, viewerId uint, limit uint) ([]Photo, error)
+	SetPhotoSensitive(photoId uint, reason string, flaggedBy uint) error
+	UnsetPhotoSensitive(photoId uint) error
 
 	// like-db methods
 
-	LikePhoto(userId uint, photoId uint) error
+	ReactToPhoto(userId uint, photoId uint, reaction string) error
 	UnlikePhoto(userId uint, photoId uint) error
 	GetLikeStatus(userId uint, photoId uint) (bool, error)
 
 	// comment-db methods
 
-	GetPhotoComments(photoId uint) ([]Comment, error)
+	GetPhotoComments(photoId uint, viewerId uint, cursor string, limit int, depth int) ([]Comment, string, error)
+	GetCommentReplies(commentId uint, viewerId uint, depth int) ([]Comment, error)
+	GetComment(photoId uint, commentId uint, viewerId uint) (Comment, error)
 	CommentPhoto(photoId uint, comment Comment) (Comment, error)
 	UncommentPhoto(photoId uint, comment Comment) error
+	EditComment(photoId uint, commentId uint, content string, mentions []string) error
+	GetCommentVersions(commentId uint) ([]CommentVersion, error)
+	DeleteComment(photoId uint, commentId uint) error
+	PinComment(photoId uint, commentId uint, maxPinned int) (bool, error)
+	UnpinComment(photoId uint, commentId uint) error
+	SetCommentsLocked(photoId uint, locked bool) error
+
+	// hidden-word-db methods
+
+	GetHiddenWords(userId uint) ([]string, error)
+	SetHiddenWords(userId uint, words []string) error
+	GetUnapprovedComments(ownerId uint, cursor string, limit int, hidden func(Comment) bool) ([]Comment, string, error)
+	ApproveComment(photoId uint, commentId uint) error
+
+	// reaction-db methods
+
+	ReplaceUnknownReactions(reactions []string) (int64, error)
+	ReactToComment(commentId uint, userId uint, reaction string) error
+	UnreactToComment(commentId uint, userId uint) error
+	DeleteCommentReactionsByBannedUser(userId uint, bannedUserId uint) error
+
+	// mention-db methods
+
+	AddMentions(photoId uint, commentId uint, authorId uint, usernames []string) error
+	GetMentionedPhotos(userId uint, viewerId uint) ([]Photo, error)
+	DeleteMentionsByBannedUser(userId uint, bannedUserId uint) error
+
+	// tag-db methods
+
+	GetPhotoTags(photoId uint) ([]Tag, error)
+	GetTaggedPhotos(userId uint, viewerId uint) ([]Photo, error)
+	TagUser(tag Tag) error
+	UntagUser(photoId uint, userId uint) error
+	DeleteTagsByBannedUser(userId uint, bannedUserId uint) error
+
+	// upload-db methods
+
+	CreateUpload(upload Upload, quota Quota, maxOpen int) (Upload, error)
+	GetUpload(uploadId string, ownerId uint) (Upload, error)
+	AppendUploadChunk(upload Upload, data []byte) (Upload, error)
+	GetUploadData(uploadId string) ([]byte, error)
+	ClaimUpload(uploadId string) (bool, error)
+	ReleaseUpload(uploadId string) error
+	FinishUpload(upload Upload, photo Photo, quota Quota, mentions []string) (Photo, error)
+	DeleteUpload(upload Upload) error
+	DeleteExpiredUploads(createdBefore time.Time) (int64, error)
+
+	// view-db methods
+
+	RecordPhotoViews(views []PhotoView) error
+	GetPhotoStats(photoId uint, pending []PhotoView) (PhotoStats, error)
+
+	// story-db methods
+
+	CreateStory(story Story, quota Quota) (Story, error)
+	GetStory(storyId uint, viewerId uint, now time.Time) (Story, error)
+	GetUserStories(ownerId uint, viewerId uint, now time.Time) ([]Story, error)
+	GetFollowedStories(viewerId uint, now time.Time) ([]Story, error)
+	DeleteStory(storyId uint, ownerId uint) error
+	MarkStorySeen(storyId uint, userId uint) error
+	GetStoryViews(storyId uint) ([]StoryView, error)
+	DeleteExpiredStories(now time.Time) (int64, error)
+	DeleteStoryViewsByBannedUser(userId uint, bannedUserId uint) error
+
+	// settings-db methods
+
+	GetSettings(userId uint) (Settings, error)
+	SetSettings(userId uint, settings Settings) error
+
+	// quota-db methods
+
+	GetUserQuota(userId uint) (*Quota, error)
+	SetUserQuota(userId uint, quota Quota) error
+	DeleteUserQuota(userId uint) error
+	GetStorageUsage(userId uint) (StorageUsage, error)
+
+	// collection-db methods
+
+	GetCollections(ownerId uint) ([]Collection, error)
+	GetCollection(collectionId uint, ownerId uint) (Collection, error)
+	CreateCollection(collection Collection) (Collection, error)
+	RenameCollection(collection Collection) (Collection, error)
+	DeleteCollection(collection Collection) error
+	GetCollectionPhotos(collection Collection) ([]Photo, error)
+	AddToCollection(collectionId uint, photoId uint) error
+	RemoveFromCollection(collectionId uint, photoId uint) error
+	ReorderCollection(collectionId uint, photoIds []uint) error
+	DeleteCollectionItemsByBannedUser(userId uint, bannedUserId uint) error
 
 	Ping() error
 }
@@ -105,7 +210,9 @@ func New(db *sql.DB) (AppDatabase, error) {
 	tables := map[string]string{
 		"Users": `CREATE TABLE Users (
                 userId INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-                username TEXT NOT NULL UNIQUE
+                username TEXT NOT NULL UNIQUE,
+                followersCount INTEGER NOT NULL DEFAULT 0,
+                photoCount INTEGER NOT NULL DEFAULT 0
             );`,
 		"Photos": `CREATE TABLE Photos (
 			photoId INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
@@ -113,14 +220,26 @@ func New(db *sql.DB) (AppDatabase, error) {
             image BLOB NOT NULL,
             mimeType TEXT NOT NULL,
             caption TEXT,
+            altText TEXT NOT NULL DEFAULT '',
             uploadTime DATETIME NOT NULL,
             likeCount INTEGER NOT NULL,
             commentsCount INTEGER NOT NULL,
+            latitude REAL,
+            longitude REAL,
+            placeName TEXT NOT NULL DEFAULT '',
+            geohash TEXT,
+            archived INTEGER NOT NULL DEFAULT 0,
+            publishAt DATETIME,
+            sensitive INTEGER NOT NULL DEFAULT 0,
+            sensitiveReason TEXT NOT NULL DEFAULT '',
+            sensitiveBy INTEGER,
+            commentsLocked INTEGER NOT NULL DEFAULT 0,
 			FOREIGN KEY (ownerId) REFERENCES Users(userId)
 		);`,
 		"Likes": `CREATE TABLE Likes (
             userId INTEGER NOT NULL,
             photoId INTEGER NOT NULL,
+            reaction TEXT NOT NULL DEFAULT '❤️',
             PRIMARY KEY (userId, photoId),
             FOREIGN KEY (userId) REFERENCES Users(userId),
             FOREIGN KEY (photoId) REFERENCES Photos(photoId)
@@ -130,8 +249,37 @@ func New(db *sql.DB) (AppDatabase, error) {
             ownerId INTEGER NOT NULL,
             content TEXT NOT NULL,
             photoId INTEGER NOT NULL,
+            parentCommentId INTEGER,
+            deleted INTEGER NOT NULL DEFAULT 0,
+            createdAt DATETIME NOT NULL DEFAULT '',
+            editedAt DATETIME,
+            pinnedAt DATETIME,
+            approved INTEGER NOT NULL DEFAULT 0,
             FOREIGN KEY (ownerId) REFERENCES Users(userId),
-            FOREIGN KEY (photoId) REFERENCES Photos(photoId)
+            FOREIGN KEY (photoId) REFERENCES Photos(photoId),
+            FOREIGN KEY (parentCommentId) REFERENCES Comments(commentId)
+        );`,
+		"CommentVersions": `CREATE TABLE CommentVersions (
+            versionId INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+            commentId INTEGER NOT NULL,
+            content TEXT NOT NULL,
+            writtenAt DATETIME NOT NULL,
+            replacedAt DATETIME NOT NULL,
+            FOREIGN KEY (commentId) REFERENCES Comments(commentId)
+        );`,
+		"CommentReactions": `CREATE TABLE CommentReactions (
+            commentId INTEGER NOT NULL,
+            userId INTEGER NOT NULL,
+            reaction TEXT NOT NULL,
+            PRIMARY KEY (commentId, userId),
+            FOREIGN KEY (commentId) REFERENCES Comments(commentId),
+            FOREIGN KEY (userId) REFERENCES Users(userId)
+        );`,
+		"HiddenWords": `CREATE TABLE HiddenWords (
+            userId INTEGER NOT NULL,
+            word TEXT NOT NULL,
+            PRIMARY KEY (userId, word),
+            FOREIGN KEY (userId) REFERENCES Users(userId)
         );`,
 		"Bans": `CREATE TABLE Bans (
 			bannedUserId INTEGER NOT NULL,
@@ -147,6 +295,113 @@ func New(db *sql.DB) (AppDatabase, error) {
             FOREIGN KEY (followerUserId) REFERENCES Users(userId),
             FOREIGN KEY (followingUserId) REFERENCES Users(userId)
 		);`,
+		"Mentions": `CREATE TABLE Mentions (
+            photoId INTEGER NOT NULL,
+            commentId INTEGER NOT NULL DEFAULT 0,
+            mentionedUserId INTEGER NOT NULL,
+            authorId INTEGER NOT NULL,
+            PRIMARY KEY (photoId, commentId, mentionedUserId),
+            FOREIGN KEY (photoId) REFERENCES Photos(photoId),
+            FOREIGN KEY (mentionedUserId) REFERENCES Users(userId),
+            FOREIGN KEY (authorId) REFERENCES Users(userId)
+		);`,
+		"Tags": `CREATE TABLE Tags (
+            photoId INTEGER NOT NULL,
+            taggedUserId INTEGER NOT NULL,
+            x REAL NOT NULL,
+            y REAL NOT NULL,
+            PRIMARY KEY (photoId, taggedUserId),
+            FOREIGN KEY (photoId) REFERENCES Photos(photoId),
+            FOREIGN KEY (taggedUserId) REFERENCES Users(userId)
+		);`,
+		"Uploads": `CREATE TABLE Uploads (
+            uploadId TEXT NOT NULL PRIMARY KEY,
+            ownerId INTEGER NOT NULL,
+            uploadLength INTEGER NOT NULL,
+            uploadOffset INTEGER NOT NULL DEFAULT 0,
+            metadata TEXT NOT NULL DEFAULT '',
+            createdAt DATETIME NOT NULL,
+            photoId INTEGER,
+            FOREIGN KEY (ownerId) REFERENCES Users(userId),
+            FOREIGN KEY (photoId) REFERENCES Photos(photoId)
+		);`,
+		"UploadChunks": `CREATE TABLE UploadChunks (
+            uploadId TEXT NOT NULL,
+            chunkOffset INTEGER NOT NULL,
+            data BLOB NOT NULL,
+            PRIMARY KEY (uploadId, chunkOffset),
+            FOREIGN KEY (uploadId) REFERENCES Uploads(uploadId)
+		);`,
+		"PhotoViews": `CREATE TABLE PhotoViews (
+            photoId INTEGER NOT NULL,
+            userId INTEGER NOT NULL,
+            kind TEXT NOT NULL,
+            windowStart DATETIME NOT NULL,
+            PRIMARY KEY (photoId, userId, kind, windowStart),
+            FOREIGN KEY (photoId) REFERENCES Photos(photoId),
+            FOREIGN KEY (userId) REFERENCES Users(userId)
+		);`,
+		"Stories": `CREATE TABLE Stories (
+            storyId INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+            ownerId INTEGER NOT NULL,
+            image BLOB NOT NULL,
+            mimeType TEXT NOT NULL,
+            caption TEXT NOT NULL DEFAULT '',
+            createdAt DATETIME NOT NULL,
+            expiresAt DATETIME NOT NULL,
+            FOREIGN KEY (ownerId) REFERENCES Users(userId)
+		);`,
+		"StoryViews": `CREATE TABLE StoryViews (
+            storyId INTEGER NOT NULL,
+            userId INTEGER NOT NULL,
+            seenAt DATETIME NOT NULL,
+            PRIMARY KEY (storyId, userId),
+            FOREIGN KEY (storyId) REFERENCES Stories(storyId),
+            FOREIGN KEY (userId) REFERENCES Users(userId)
+		);`,
+		"Settings": `CREATE TABLE Settings (
+            userId INTEGER NOT NULL PRIMARY KEY,
+            sensitiveMedia TEXT NOT NULL DEFAULT 'blur',
+            FOREIGN KEY (userId) REFERENCES Users(userId)
+		);`,
+		"Quotas": `CREATE TABLE Quotas (
+            userId INTEGER NOT NULL PRIMARY KEY,
+            maxBytes INTEGER NOT NULL,
+            maxPhotos INTEGER NOT NULL,
+            maxDailyBytes INTEGER NOT NULL,
+            maxDailyPhotos INTEGER NOT NULL,
+            FOREIGN KEY (userId) REFERENCES Users(userId)
+		);`,
+		"StorageUsage": `CREATE TABLE StorageUsage (
+            userId INTEGER NOT NULL PRIMARY KEY,
+            bytes INTEGER NOT NULL,
+            photos INTEGER NOT NULL,
+            FOREIGN KEY (userId) REFERENCES Users(userId)
+		);`,
+		"DailyUploads": `CREATE TABLE DailyUploads (
+            userId INTEGER NOT NULL,
+            day TEXT NOT NULL,
+            bytes INTEGER NOT NULL,
+            photos INTEGER NOT NULL,
+            PRIMARY KEY (userId, day),
+            FOREIGN KEY (userId) REFERENCES Users(userId)
+		);`,
+		"Collections": `CREATE TABLE Collections (
+            collectionId INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+            ownerId INTEGER NOT NULL,
+            name TEXT NOT NULL,
+            createdAt DATETIME NOT NULL,
+            UNIQUE (ownerId, name),
+            FOREIGN KEY (ownerId) REFERENCES Users(userId)
+		);`,
+		"CollectionItems": `CREATE TABLE CollectionItems (
+            collectionId INTEGER NOT NULL,
+            photoId INTEGER NOT NULL,
+            position INTEGER NOT NULL,
+            PRIMARY KEY (collectionId, photoId),
+            FOREIGN KEY (collectionId) REFERENCES Collections(collectionId),
+            FOREIGN KEY (photoId) REFERENCES Photos(photoId)
+		);`,
 	}
 
 	// Iterate over the tables map
@@ -168,6 +423,104 @@ func New(db *sql.DB) (AppDatabase, error) {
 		}
 	}
 
+	// Columns added to the tables above after their first release, missing in databases created before then
+	columns := []struct {
+		table      string
+		name       string
+		definition string
+	}{
+		{"Users", "followersCount", "INTEGER NOT NULL DEFAULT 0"},
+		{"Users", "photoCount", "INTEGER NOT NULL DEFAULT 0"},
+		{"Photos", "latitude", "REAL"},
+		{"Photos", "longitude", "REAL"},
+		{"Photos", "placeName", "TEXT NOT NULL DEFAULT ''"},
+		{"Photos", "geohash", "TEXT"},
+		{"Photos", "archived", "INTEGER NOT NULL DEFAULT 0"},
+		{"Photos", "publishAt", "DATETIME"},
+		{"Photos", "altText", "TEXT NOT NULL DEFAULT ''"},
+		{"Photos", "sensitive", "INTEGER NOT NULL DEFAULT 0"},
+		{"Photos", "sensitiveReason", "TEXT NOT NULL DEFAULT ''"},
+		{"Photos", "sensitiveBy", "INTEGER"},
+		{"Photos", "commentsLocked", "INTEGER NOT NULL DEFAULT 0"},
+		{"Photos", "animated", "INTEGER NOT NULL DEFAULT 0"},
+		{"Likes", "reaction", "TEXT NOT NULL DEFAULT '❤️'"},
+		{"Comments", "parentCommentId", "INTEGER"},
+		{"Comments", "deleted", "INTEGER NOT NULL DEFAULT 0"},
+		{"Comments", "createdAt", "DATETIME NOT NULL DEFAULT ''"},
+		{"Comments", "editedAt", "DATETIME"},
+		{"Comments", "pinnedAt", "DATETIME"},
+		{"Comments", "approved", "INTEGER NOT NULL DEFAULT 0"},
+	}
+
+	// Iterate over the columns, adding the missing ones
+	added := make(map[string]bool)
+	for _, column := range columns {
+		var exists bool
+		err := db.QueryRow(`
+            SELECT EXISTS(
+                SELECT 1 FROM pragma_table_info(?)
+                WHERE name = ?
+            )`, column.table, column.name,
+		).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("error checking for `%s.%s` column: %w", column.table, column.name, err)
+		}
+		if !exists {
+			alterQuery := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", column.table, column.name, column.definition)
+			if _, err = db.Exec(alterQuery); err != nil {
+				return nil, fmt.Errorf("error adding `%s.%s` column: %w", column.table, column.name, err)
+			}
+			added[column.table+"."+column.name] = true
+		}
+	}
+
+	// Counters added to the tables above after their first release, computed from the rows they count when added
+	counters := map[string]string{
+		"Users.followersCount": `UPDATE Users SET followersCount = (SELECT COUNT(*) FROM Followers WHERE followingUserId = Users.userId);`,
+		"Users.photoCount":     `UPDATE Users SET photoCount = (SELECT COUNT(*) FROM Photos WHERE ownerId = Users.userId AND archived = 0 AND publishAt IS NULL);`,
+	}
+	for column, countQuery := range counters {
+		if added[column] {
+			if _, err := db.Exec(countQuery); err != nil {
+				return nil, fmt.Errorf("error counting `%s` column: %w", column, err)
+			}
+		}
+	}
+
+	// The animated flag is computed from the images of the photos stored before it existed
+	if added["Photos.animated"] {
+		if err := markAnimatedPhotos(db); err != nil {
+			return nil, fmt.Errorf("error computing `Photos.animated` column: %w", err)
+		}
+	}
+
+	// Indexes used by the queries, created after all the columns they refer to exist
+	indexes := map[string]string{
+		"PhotosGeohash":          `CREATE INDEX IF NOT EXISTS PhotosGeohash ON Photos (geohash);`,
+		"PhotosPublishAt":        `CREATE INDEX IF NOT EXISTS PhotosPublishAt ON Photos (publishAt) WHERE publishAt IS NOT NULL;`,
+		"CommentsPhoto":          `CREATE INDEX IF NOT EXISTS CommentsPhoto ON Comments (photoId);`,
+		"CommentsParent":         `CREATE INDEX IF NOT EXISTS CommentsParent ON Comments (parentCommentId) WHERE parentCommentId IS NOT NULL;`,
+		"CommentVersionsComment": `CREATE INDEX IF NOT EXISTS CommentVersionsComment ON CommentVersions (commentId);`,
+		"CommentReactionsUser":   `CREATE INDEX IF NOT EXISTS CommentReactionsUser ON CommentReactions (userId);`,
+		"LikesPhoto":             `CREATE INDEX IF NOT EXISTS LikesPhoto ON Likes (photoId, reaction);`,
+		"FollowersFollowing":     `CREATE INDEX IF NOT EXISTS FollowersFollowing ON Followers (followingUserId, followerUserId);`,
+		"BansBanned":             `CREATE INDEX IF NOT EXISTS BansBanned ON Bans (bannedUserId);`,
+		"UsersUsername":          `CREATE INDEX IF NOT EXISTS UsersUsername ON Users (username COLLATE NOCASE);`,
+		"UsersFollowersCount":    `CREATE INDEX IF NOT EXISTS UsersFollowersCount ON Users (followersCount, userId);`,
+		"UsersPhotoCount":        `CREATE INDEX IF NOT EXISTS UsersPhotoCount ON Users (photoCount, userId);`,
+		"PhotosStream":           `CREATE INDEX IF NOT EXISTS PhotosStream ON Photos (uploadTime, photoId) WHERE archived = 0 AND publishAt IS NULL;`,
+		"PhotosOwner":            `CREATE INDEX IF NOT EXISTS PhotosOwner ON Photos (ownerId, uploadTime);`,
+		"StoriesOwner":           `CREATE INDEX IF NOT EXISTS StoriesOwner ON Stories (ownerId, expiresAt);`,
+		"StoriesExpiresAt":       `CREATE INDEX IF NOT EXISTS StoriesExpiresAt ON Stories (expiresAt);`,
+	}
+
+	// Iterate over the indexes map, creating the missing ones
+	for indexName, createQuery := range indexes {
+		if _, err := db.Exec(createQuery); err != nil {
+			return nil, fmt.Errorf("error creating `%s` index: %w", indexName, err)
+		}
+	}
+
 	return &appdbimpl{c: db}, nil
 }
 
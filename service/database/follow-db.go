@@ -6,46 +6,21 @@ import (
 	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
 )
 
-// GetFollowersList returns the list of followers of a user.
-func (db *appdbimpl) GetFollowersList(userId uint) ([]User, error) {
-	rows, err := db.c.Query(`
-        SELECT followerUserId FROM Followers
-        WHERE followingUserId = ?`,
-		userId,
-	)
-	if err != nil {
-		return nil, err
+// GetFollowersList returns a page of the list of followers of a user, sorted by id.
+func (db *appdbimpl) GetFollowersList(userId uint, cursor string, limit int) ([]User, string, error) {
+	var afterId uint
+	if err := decodeCursor(cursor, &afterId); err != nil {
+		return nil, "", err
 	}
-	defer func() { _ = rows.Close() }()
 
-	var followerIds []uint
-	for rows.Next() {
-		var followerId uint
-		if err = rows.Scan(&followerId); err != nil {
-			return nil, err
-		}
-		followerIds = append(followerIds, followerId)
-	}
-
-	followers := make([]User, 0)
-	for _, followerId := range followerIds {
-		row := db.c.QueryRow(`
-            SELECT username FROM Users
-            WHERE userId = ?`,
-			followerId,
-		)
-		var username string
-		if err = row.Scan(&username); err != nil {
-			return nil, err
-		}
-		followers = append(followers, User{UserId: followerId, Username: username})
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return followers, nil
+	return db.queryUserPage(`
+        SELECT Users.userId, Users.username FROM Followers
+        INNER JOIN Users ON Users.userId = Followers.followerUserId
+        WHERE Followers.followingUserId = ? AND Followers.followerUserId > ?
+        ORDER BY Followers.followerUserId
+        LIMIT ?`,
+		limit, userId, afterId, limit+1,
+	)
 }
 
 // GetFollowersCount returns the number of followers of a user.
@@ -63,46 +38,21 @@ func (db *appdbimpl) GetFollowersCount(userId uint) (uint, error) {
 	return count, nil
 }
 
-// GetFollowingList returns the list of users followed by a user.
-func (db *appdbimpl) GetFollowingList(userId uint) ([]User, error) {
-	rows, err := db.c.Query(`
-        SELECT followingUserId FROM Followers
-        WHERE followerUserId = ?`,
-		userId,
-	)
-	if err != nil {
-		return nil, err
-	}
-	defer func() { _ = rows.Close() }()
-
-	var followingIds []uint
-	for rows.Next() {
-		var followingId uint
-		if err = rows.Scan(&followingId); err != nil {
-			return nil, err
-		}
-		followingIds = append(followingIds, followingId)
-	}
-
-	following := make([]User, 0)
-	for _, followingId := range followingIds {
-		row := db.c.QueryRow(`
-            SELECT username FROM Users
-            WHERE userId = ?`,
-			followingId,
-		)
-		var username string
-		if err = row.Scan(&username); err != nil {
-			return nil, err
-		}
-		following = append(following, User{UserId: followingId, Username: username})
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
+// GetFollowingList returns a page of the list of users followed by a user, sorted by id.
+func (db *appdbimpl) GetFollowingList(userId uint, cursor string, limit int) ([]User, string, error) {
+	var afterId uint
+	if err := decodeCursor(cursor, &afterId); err != nil {
+		return nil, "", err
 	}
 
-	return following, nil
+	return db.queryUserPage(`
+        SELECT Users.userId, Users.username FROM Followers
+        INNER JOIN Users ON Users.userId = Followers.followingUserId
+        WHERE Followers.followerUserId = ? AND Followers.followingUserId > ?
+        ORDER BY Followers.followingUserId
+        LIMIT ?`,
+		limit, userId, afterId, limit+1,
+	)
 }
 
 // GetFollowingCount returns the number of users followed by a user.
@@ -143,19 +93,42 @@ func (db *appdbimpl) GetFollowStatus(userId uint, targetUserId uint) (bool, erro
 
 // FollowUser add the user with id `targetUserId` to the list of following of the user with id `userId`.
 func (db *appdbimpl) FollowUser(userId uint, targetUserId uint) error {
-	if _, err := db.c.Exec(`
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err = tx.Exec(`
         INSERT INTO Followers (followerUserId, followingUserId)
         VALUES (?, ?)`,
 		userId, targetUserId,
 	); err != nil {
 		return err
 	}
-	return nil
+
+	// Increment the followersCount field of the followed user
+	if _, err = tx.Exec(`
+        UPDATE Users
+        SET followersCount = followersCount + 1
+        WHERE userId = ?`,
+		targetUserId,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // UnfollowUser remove the user with id `targetUserId` from the list of following of the user with id `userId`.
 func (db *appdbimpl) UnfollowUser(userId uint, targetUserId uint) error {
-	_, err := db.c.Exec(`
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.Exec(`
         DELETE FROM Followers
         WHERE followerUserId = ? AND followingUserId = ?`,
 		userId, targetUserId,
@@ -164,5 +137,138 @@ func (db *appdbimpl) UnfollowUser(userId uint, targetUserId uint) error {
 		return err
 	}
 
-	return nil
+	// Decrement the followersCount field of the unfollowed user, if they were followed
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return err
+	}
+	if _, err = tx.Exec(`
+        UPDATE Users
+        SET followersCount = followersCount - 1
+        WHERE userId = ?`,
+		targetUserId,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/*
+GetSuggestions returns up to `limit` users suggested to the user with id `userId` to follow.
+
+The candidates are the users followed by the users they follow, and the users who liked the same photos as them.
+They are ranked by number of mutual followers, then by number of shared likes, then by the time of their last
+published photo, excluding the users already followed and the ones banned by or banning the user.
+*/
+func (db *appdbimpl) GetSuggestions(userId uint, limit int) ([]Suggestion, error) {
+	rows, err := db.c.Query(`
+        WITH Following AS (
+            SELECT followingUserId AS userId FROM Followers
+            WHERE followerUserId = ?1
+        ), Excluded AS (
+            SELECT ?1 AS userId
+            UNION SELECT userId FROM Following
+            UNION SELECT bannedUserId FROM Bans WHERE userId = ?1
+            UNION SELECT userId FROM Bans WHERE bannedUserId = ?1
+        ), Mutuals AS (
+            SELECT Followers.followingUserId AS userId, COUNT(*) AS count FROM Followers
+            JOIN Following ON Following.userId = Followers.followerUserId
+            GROUP BY Followers.followingUserId
+        ), SharedLikes AS (
+            SELECT Others.userId, COUNT(*) AS count FROM Likes AS Mine
+            JOIN Likes AS Others ON Others.photoId = Mine.photoId AND Others.userId != Mine.userId
+            WHERE Mine.userId = ?1
+            GROUP BY Others.userId
+        ), Candidates AS (
+            SELECT userId FROM Mutuals
+            UNION SELECT userId FROM SharedLikes
+        )
+        SELECT Users.userId, Users.username, COALESCE(Mutuals.count, 0) AS mutuals, COALESCE(SharedLikes.count, 0) AS shared,
+            COALESCE((
+                SELECT MAX(uploadTime) FROM Photos
+                WHERE ownerId = Users.userId AND `+photoPublished+`
+            ), '') AS lastPostedAt
+        FROM Candidates
+        JOIN Users ON Users.userId = Candidates.userId
+        LEFT JOIN Mutuals ON Mutuals.userId = Candidates.userId
+        LEFT JOIN SharedLikes ON SharedLikes.userId = Candidates.userId
+        WHERE Candidates.userId NOT IN (SELECT userId FROM Excluded)
+        ORDER BY mutuals DESC, shared DESC, lastPostedAt DESC, Users.userId
+        LIMIT ?2`,
+		userId, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	suggestions := make([]Suggestion, 0)
+	for rows.Next() {
+		var suggestion Suggestion
+		if err = rows.Scan(&suggestion.UserId, &suggestion.Username, &suggestion.MutualFollowers, &suggestion.SharedLikes, &suggestion.LastPostedAt); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+/*
+GetRelationship returns the relationship between the user with id `userId` and the user with id `targetUserId`.
+
+Along with the follows and bans in both directions, it returns up to `mutualsLimit` of the users followed by the
+user who follow the target user, by username, and their total count.
+*/
+func (db *appdbimpl) GetRelationship(userId uint, targetUserId uint, mutualsLimit int) (Relationship, error) {
+	relationship := Relationship{MutualFollowers: make([]User, 0)}
+	if err := db.c.QueryRow(`
+        SELECT
+            EXISTS(SELECT 1 FROM Followers WHERE followerUserId = ?1 AND followingUserId = ?2),
+            EXISTS(SELECT 1 FROM Followers WHERE followerUserId = ?2 AND followingUserId = ?1),
+            EXISTS(SELECT 1 FROM Bans WHERE userId = ?1 AND bannedUserId = ?2),
+            EXISTS(SELECT 1 FROM Bans WHERE userId = ?2 AND bannedUserId = ?1),
+            (
+                SELECT COUNT(*) FROM Followers AS Mine
+                JOIN Followers AS Theirs ON Theirs.followerUserId = Mine.followingUserId
+                WHERE Mine.followerUserId = ?1 AND Theirs.followingUserId = ?2
+            )`,
+		userId, targetUserId,
+	).Scan(&relationship.Following, &relationship.FollowedBy, &relationship.Banned, &relationship.BannedBy, &relationship.MutualFollowersCount); err != nil {
+		return relationship, err
+	}
+
+	if relationship.MutualFollowersCount == 0 || mutualsLimit == 0 {
+		return relationship, nil
+	}
+
+	rows, err := db.c.Query(`
+        SELECT Users.userId, Users.username FROM Followers AS Mine
+        JOIN Followers AS Theirs ON Theirs.followerUserId = Mine.followingUserId
+        JOIN Users ON Users.userId = Mine.followingUserId
+        WHERE Mine.followerUserId = ? AND Theirs.followingUserId = ?
+        ORDER BY Users.username
+        LIMIT ?`,
+		userId, targetUserId, mutualsLimit,
+	)
+	if err != nil {
+		return relationship, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var user User
+		if err = rows.Scan(&user.UserId, &user.Username); err != nil {
+			return relationship, err
+		}
+		relationship.MutualFollowers = append(relationship.MutualFollowers, user)
+	}
+	if err = rows.Err(); err != nil {
+		return relationship, err
+	}
+
+	return relationship, nil
 }
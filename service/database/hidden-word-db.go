@@ -0,0 +1,140 @@
+package database
+
+import . "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+
+// GetHiddenWords Get the words and phrases a user hides from the comments on their photos, in alphabetical order.
+func (db *appdbimpl) GetHiddenWords(userId uint) ([]string, error) {
+	rows, err := db.c.Query(`
+        SELECT word FROM HiddenWords
+        WHERE userId = ?
+        ORDER BY word`,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	words := make([]string, 0)
+	for rows.Next() {
+		var word string
+		if err = rows.Scan(&word); err != nil {
+			return nil, err
+		}
+		words = append(words, word)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return words, nil
+}
+
+// SetHiddenWords Replace the words and phrases a user hides from the comments on their photos.
+func (db *appdbimpl) SetHiddenWords(userId uint, words []string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(`
+        DELETE FROM HiddenWords
+        WHERE userId = ?`,
+		userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, word := range words {
+		_, err = tx.Exec(`
+            INSERT OR IGNORE INTO HiddenWords (userId, word)
+            VALUES (?, ?)`,
+			userId, word,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// unapprovedBatchSize is the number of unapproved comments read at once while looking for the hidden ones.
+const unapprovedBatchSize = 500
+
+/*
+GetUnapprovedComments Get a page of the comments on the photos of a user that they did not approve and that are hidden,
+from oldest to newest. The comments of the user themselves and the deleted ones are excluded.
+The unapproved comments are read in batches until the page is full, keeping the ones for which hidden returns true, so
+a page holds fewer than limit comments only if it is the last one.
+*/
+func (db *appdbimpl) GetUnapprovedComments(ownerId uint, cursor string, limit int, hidden func(Comment) bool) ([]Comment, string, error) {
+	var createdAt string
+	var afterId uint
+	if err := decodeCursor(cursor, &createdAt, &afterId); err != nil {
+		return nil, "", err
+	}
+
+	comments := make([]Comment, 0, limit)
+	nextCursor := ""
+	for {
+		batch, err := db.queryComments(`
+			SELECT `+commentColumns+`
+			FROM Comments
+			INNER JOIN Users ON Comments.ownerId = Users.userId
+			INNER JOIN Photos ON Comments.photoId = Photos.photoId
+			WHERE Photos.ownerId = ? AND Comments.ownerId != ? AND Comments.approved = 0 AND Comments.deleted = 0
+				AND (Comments.createdAt, Comments.commentId) > (?, ?)
+			ORDER BY Comments.createdAt, Comments.commentId
+			LIMIT ?`,
+			ownerId, ownerId, createdAt, afterId, unapprovedBatchSize,
+		)
+		if err != nil {
+			return nil, "", err
+		}
+
+		// Keep the hidden comments, a next page exists only if one more is found after the page is full
+		full := false
+		for _, comment := range batch {
+			if !hidden(comment) {
+				continue
+			}
+			if len(comments) == limit {
+				last := comments[limit-1]
+				nextCursor = encodeCursor(last.CreatedAt, last.CommentId)
+				full = true
+				break
+			}
+			comments = append(comments, comment)
+		}
+		if full || len(batch) < unapprovedBatchSize {
+			break
+		}
+		createdAt, afterId = batch[len(batch)-1].CreatedAt, batch[len(batch)-1].CommentId
+	}
+
+	err := db.addCommentReactions(comments, ownerId, `commentId IN (SELECT value FROM json_each(?))`, commentIds(comments))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return comments, nextCursor, nil
+}
+
+// ApproveComment Approve a comment under a photo, so that the hidden words of the owner of the photo do not apply to it.
+func (db *appdbimpl) ApproveComment(photoId uint, commentId uint) error {
+	_, err := db.c.Exec(`
+        UPDATE Comments
+        SET approved = 1
+        WHERE commentId = ? AND photoId = ?`,
+		commentId, photoId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -1,15 +1,33 @@
 package database
 
-// LikePhoto Add a like to a photo.
-func (db *appdbimpl) LikePhoto(userId uint, photoId uint) error {
-	_, err := db.c.Exec(`
-        INSERT INTO Likes (userId, photoId)
-        VALUES (?, ?)`,
-		userId, photoId,
+/*
+ReactToPhoto Add the reaction of a user to a photo, replacing their previous one.
+Each user holds at most one reaction per photo, counted once in the LikeCount field of the photo.
+*/
+func (db *appdbimpl) ReactToPhoto(userId uint, photoId uint, reaction string) error {
+	res, err := db.c.Exec(`
+        INSERT OR IGNORE INTO Likes (userId, photoId, reaction)
+        VALUES (?, ?, ?)`,
+		userId, photoId, reaction,
 	)
 	if err != nil {
 		return err
 	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// Replace the previous reaction of the user
+	if inserted == 0 {
+		_, err = db.c.Exec(`
+            UPDATE Likes
+            SET reaction = ?
+            WHERE userId = ? AND photoId = ?`,
+			reaction, userId, photoId,
+		)
+		return err
+	}
 
 	// Increment the LikeCount field of the photo
 	_, err = db.c.Exec(`
@@ -25,9 +43,9 @@ func (db *appdbimpl) LikePhoto(userId uint, photoId uint) error {
 	return nil
 }
 
-// UnlikePhoto Remove a like from a photo.
+// UnlikePhoto Remove the like, or any other reaction, of a user from a photo.
 func (db *appdbimpl) UnlikePhoto(userId uint, photoId uint) error {
-	_, err := db.c.Exec(`
+	res, err := db.c.Exec(`
         DELETE FROM Likes
         WHERE userId = ? AND photoId = ?`,
 		userId, photoId,
@@ -35,6 +53,10 @@ func (db *appdbimpl) UnlikePhoto(userId uint, photoId uint) error {
 	if err != nil {
 		return err
 	}
+	deleted, err := res.RowsAffected()
+	if err != nil || deleted == 0 {
+		return err
+	}
 
 	// Decrement the LikeCount field of the photo
 	_, err = db.c.Exec(`
@@ -50,7 +72,7 @@ func (db *appdbimpl) UnlikePhoto(userId uint, photoId uint) error {
 	return nil
 }
 
-// GetLikeStatus Check if a user has liked a photo.
+// GetLikeStatus Check if a user has liked, or reacted to, a photo.
 func (db *appdbimpl) GetLikeStatus(userId uint, photoId uint) (bool, error) {
 	var exists bool
 	err := db.c.QueryRow(`
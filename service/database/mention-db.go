@@ -0,0 +1,78 @@
+package database
+
+import (
+	"database/sql"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+)
+
+// execer is implemented by both *sql.DB and *sql.Tx, to run the same statements inside a transaction or not.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx, to read a row inside a transaction or not.
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+/*
+AddMentions stores the mentions of the given usernames made by the user with id `authorId`.
+
+A `commentId` of 0 means the mentions were made in the caption of the photo, otherwise in the given comment.
+Mentions are linked to the user ids, so they survive any later username change.
+Usernames that do not belong to any user, the author themselves, and users who have banned the author are ignored.
+*/
+func (db *appdbimpl) AddMentions(photoId uint, commentId uint, authorId uint, usernames []string) error {
+	return addMentions(db.c, photoId, commentId, authorId, usernames)
+}
+
+// addMentions stores the mentions as AddMentions, running the statements via `ex`.
+func addMentions(ex execer, photoId uint, commentId uint, authorId uint, usernames []string) error {
+	for _, username := range usernames {
+		_, err := ex.Exec(`
+            INSERT OR IGNORE INTO Mentions (photoId, commentId, mentionedUserId, authorId)
+            SELECT ?, ?, userId, ? FROM Users
+            WHERE username = ? AND userId != ? AND userId NOT IN (
+                SELECT userId FROM Bans WHERE bannedUserId = ?
+            )`,
+			photoId, commentId, authorId, username, authorId, authorId,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+GetMentionedPhotos Get the list of photos in which a user was mentioned, either in the caption or in a comment.
+Only the photos visible to the user with id `viewerId` are returned.
+The photos are sorted by date, from newest to oldest.
+*/
+func (db *appdbimpl) GetMentionedPhotos(userId uint, viewerId uint) ([]Photo, error) {
+	return db.queryPhotos(
+		`SELECT `+photoColumns+`
+		FROM Photos
+		INNER JOIN Users ON Photos.ownerId = Users.userId
+		WHERE Photos.photoId IN (
+			SELECT photoId FROM Mentions WHERE mentionedUserId = ?
+		) AND `+photoVisibleTo+`
+		ORDER BY uploadTime DESC`,
+		userId, viewerId,
+	)
+}
+
+// DeleteMentionsByBannedUser Remove all mentions of the requester made by a banned user.
+func (db *appdbimpl) DeleteMentionsByBannedUser(userId uint, bannedUserId uint) error {
+	_, err := db.c.Exec(`
+        DELETE FROM Mentions
+        WHERE mentionedUserId = ? AND authorId = ?`,
+		userId, bannedUserId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -2,51 +2,98 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/geo"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/globaltime"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/imaging"
 	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"math"
+	"strings"
 	"time"
 )
 
-// GetPhoto Get a photo by its id.
-func (db *appdbimpl) GetPhoto(photoId uint) (Photo, error) {
+/*
+photoColumns is the list of columns selected whenever a Photo is read from the database.
+The reactions are aggregated in a JSON object, mapping each reaction to its count.
+The order of the columns must match the one expected by scanPhoto.
+*/
+const photoColumns = `Photos.photoId, Photos.ownerId, Users.username, Photos.image, Photos.mimeType, Photos.caption, Photos.altText, Photos.uploadTime, Photos.likeCount, Photos.commentsCount, Photos.latitude, Photos.longitude, Photos.placeName, Photos.archived, Photos.publishAt, Photos.sensitive, Photos.sensitiveReason, Photos.sensitiveBy, Photos.commentsLocked, Photos.animated,
+	(SELECT json_group_object(reaction, count) FROM (SELECT reaction, COUNT(*) AS count FROM Likes WHERE Likes.photoId = Photos.photoId GROUP BY reaction))`
+
+/*
+streamColumns is the list of columns selected for the photos of a stream, in the order expected by scanPhoto.
+The image is left out, so that a page of the stream never loads the BLOBs: clients fetch each image on its own.
+*/
+const streamColumns = `Photos.photoId, Photos.ownerId, Users.username, NULL, Photos.mimeType, Photos.caption, Photos.altText, Photos.uploadTime, Photos.likeCount, Photos.commentsCount, Photos.latitude, Photos.longitude, Photos.placeName, Photos.archived, Photos.publishAt, Photos.sensitive, Photos.sensitiveReason, Photos.sensitiveBy, Photos.commentsLocked, Photos.animated,
+	(SELECT json_group_object(reaction, count) FROM (SELECT reaction, COUNT(*) AS count FROM Likes WHERE Likes.photoId = Photos.photoId GROUP BY reaction))`
+
+/*
+photoPublished is a condition restricting the Photos to the ones shown on profiles and streams.
+Archived and scheduled photos are only listed to their owner by GetArchivedPhotos and GetScheduledPhotos.
+*/
+const photoPublished = `Photos.archived = 0 AND Photos.publishAt IS NULL`
+
+/*
+photoVisibleTo is a condition restricting the Photos to the ones a viewer is allowed to see.
+The id of the viewer must be bound to its only parameter.
+*/
+const photoVisibleTo = photoPublished + ` AND Photos.ownerId NOT IN (SELECT userId FROM Bans WHERE bannedUserId = ?)`
+
+/*
+photoBefore is a condition restricting the Photos to the ones after a cursor, when sorted from newest to oldest.
+The upload time and the id of the last photo of the previous page must be bound to its parameters.
+*/
+const photoBefore = `(Photos.uploadTime, Photos.photoId) < (?, ?)`
+
+// endOfTime is an upload time later than the one of every photo, used as the cursor of the first page of photos.
+const endOfTime = "9999-12-31T23:59:59Z"
+
+// likeEscaper escapes the wildcards of a LIKE pattern, using `\` as the escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPhoto scans a row selected via photoColumns into a Photo.
+func scanPhoto(row rowScanner) (Photo, error) {
 	var photo Photo
-	if err := db.c.QueryRow(
-		`SELECT Photos.photoId, Photos.ownerId, Users.username, Photos.image, Photos.mimeType, Photos.caption, Photos.uploadTime, Photos.likeCount, Photos.commentsCount
-		FROM Photos
-		INNER JOIN Users ON Photos.ownerId = Users.userId
-		WHERE photoId = ?`,
-		photoId,
-	).Scan(
+	var reactions string
+	err := row.Scan(
 		&photo.PhotoId,
 		&photo.OwnerId,
 		&photo.OwnerUsername,
 		&photo.Image,
 		&photo.MimeType,
 		&photo.Caption,
+		&photo.AltText,
 		&photo.UploadTime,
 		&photo.LikeCount,
 		&photo.CommentsCount,
-	); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return Photo{}, errors.New("photo does not exist")
-		}
+		&photo.Latitude,
+		&photo.Longitude,
+		&photo.PlaceName,
+		&photo.Archived,
+		&photo.PublishAt,
+		&photo.Sensitive,
+		&photo.SensitiveReason,
+		&photo.SensitiveBy,
+		&photo.CommentsLocked,
+		&photo.Animated,
+		&reactions,
+	)
+	if err != nil {
+		return photo, err
 	}
-	return photo, nil
+	err = json.Unmarshal([]byte(reactions), &photo.Reactions)
+	return photo, err
 }
 
-/*
-GetPhotoList Get a list of photos uploaded by a user.
-The photos are sorted by date, from newest to oldest.
-*/
-func (db *appdbimpl) GetPhotoList(userId uint) ([]Photo, error) {
-	rows, err := db.c.Query(
-		`SELECT Photos.photoId, Photos.ownerId, Users.username, Photos.image, Photos.mimeType, Photos.caption, Photos.uploadTime, Photos.likeCount, Photos.commentsCount
-		FROM Photos
-		INNER JOIN Users ON Photos.ownerId = Users.userId
-		WHERE ownerId = ?
-		ORDER BY uploadTime DESC`,
-		userId,
-	)
+// queryPhotos runs a query selecting photoColumns and returns the resulting list of photos.
+func (db *appdbimpl) queryPhotos(query string, args ...interface{}) ([]Photo, error) {
+	rows, err := db.c.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -54,18 +101,8 @@ func (db *appdbimpl) GetPhotoList(userId uint) ([]Photo, error) {
 
 	photos := make([]Photo, 0)
 	for rows.Next() {
-		var photo Photo
-		if err := rows.Scan(
-			&photo.PhotoId,
-			&photo.OwnerId,
-			&photo.OwnerUsername,
-			&photo.Image,
-			&photo.MimeType,
-			&photo.Caption,
-			&photo.UploadTime,
-			&photo.LikeCount,
-			&photo.CommentsCount,
-		); err != nil {
+		photo, err := scanPhoto(rows)
+		if err != nil {
 			return nil, err
 		}
 		photos = append(photos, photo)
@@ -78,12 +115,141 @@ func (db *appdbimpl) GetPhotoList(userId uint) ([]Photo, error) {
 	return photos, nil
 }
 
-// GetPhotoCount Get the number of photos uploaded by a user.
+// decodePhotoCursor decodes the cursor of a page of photos into the arguments of photoBefore.
+func decodePhotoCursor(cursor string) (string, uint, error) {
+	uploadTime, photoId := endOfTime, uint(0)
+	err := decodeCursor(cursor, &uploadTime, &photoId)
+	return uploadTime, photoId, err
+}
+
+/*
+queryPhotoPage runs a query selecting photoColumns of up to limit+1 photos, sorted from newest to oldest.
+It returns the first `limit` of them, and the cursor to the next page if there is one.
+*/
+func (db *appdbimpl) queryPhotoPage(query string, limit int, args ...interface{}) ([]Photo, string, error) {
+	photos, err := db.queryPhotos(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(photos) > limit {
+		photos = photos[:limit]
+		nextCursor = encodeCursor(photos[limit-1].UploadTime, photos[limit-1].PhotoId)
+	}
+	return photos, nextCursor, nil
+}
+
+// GetPhoto Get a photo by its id.
+func (db *appdbimpl) GetPhoto(photoId uint) (Photo, error) {
+	photo, err := scanPhoto(db.c.QueryRow(
+		`SELECT `+photoColumns+`
+		FROM Photos
+		INNER JOIN Users ON Photos.ownerId = Users.userId
+		WHERE photoId = ?`,
+		photoId,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Photo{}, errors.New("photo does not exist")
+		}
+		return Photo{}, err
+	}
+	return photo, nil
+}
+
+/*
+GetVisiblePhoto Get a photo by its id, if the user with id `viewerId` is allowed to see it.
+Archived and scheduled photos only exist for their owner, as if they were not published yet.
+*/
+func (db *appdbimpl) GetVisiblePhoto(photoId uint, viewerId uint) (Photo, error) {
+	photo, err := scanPhoto(db.c.QueryRow(
+		`SELECT `+photoColumns+`
+		FROM Photos
+		INNER JOIN Users ON Photos.ownerId = Users.userId
+		WHERE photoId = ? AND (`+photoPublished+` OR Photos.ownerId = ?)`,
+		photoId, viewerId,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Photo{}, errors.New("photo does not exist")
+		}
+		return Photo{}, err
+	}
+	return photo, nil
+}
+
+/*
+GetPhotoList Get a page of the list of photos uploaded by a user, excluding the archived and scheduled ones.
+The photos are sorted by date, from newest to oldest.
+*/
+func (db *appdbimpl) GetPhotoList(userId uint, cursor string, limit int) ([]Photo, string, error) {
+	uploadTime, photoId, err := decodePhotoCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return db.queryPhotoPage(
+		`SELECT `+photoColumns+`
+		FROM Photos
+		INNER JOIN Users ON Photos.ownerId = Users.userId
+		WHERE ownerId = ? AND `+photoPublished+` AND `+photoBefore+`
+		ORDER BY Photos.uploadTime DESC, Photos.photoId DESC
+		LIMIT ?`,
+		limit, userId, uploadTime, photoId, limit+1,
+	)
+}
+
+/*
+GetArchivedPhotos Get the list of photos archived by a user.
+The photos are sorted by date, from newest to oldest.
+*/
+func (db *appdbimpl) GetArchivedPhotos(userId uint) ([]Photo, error) {
+	return db.queryPhotos(
+		`SELECT `+photoColumns+`
+		FROM Photos
+		INNER JOIN Users ON Photos.ownerId = Users.userId
+		WHERE ownerId = ? AND archived = 1
+		ORDER BY uploadTime DESC`,
+		userId,
+	)
+}
+
+// SetPhotoArchived Archive a photo, hiding it from everyone but its owner, or restore it.
+func (db *appdbimpl) SetPhotoArchived(photoId uint, archived bool) error {
+	res, err := db.c.Exec(`
+        UPDATE Photos
+        SET archived = ?
+        WHERE photoId = ? AND archived != ?`,
+		archived, photoId, archived,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Update the photoCount field of the owner, unless the photo was already archived or restored, or is scheduled
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return err
+	}
+	delta := 1
+	if archived {
+		delta = -1
+	}
+	_, err = db.c.Exec(`
+        UPDATE Users
+        SET photoCount = photoCount + ?
+        WHERE userId = (SELECT ownerId FROM Photos WHERE photoId = ? AND publishAt IS NULL)`,
+		delta, photoId,
+	)
+	return err
+}
+
+// GetPhotoCount Get the number of photos uploaded by a user, excluding the archived and scheduled ones.
 func (db *appdbimpl) GetPhotoCount(userId uint) (uint, error) {
 	var count uint
 	if err := db.c.QueryRow(`
         SELECT COUNT(*) FROM Photos
-        WHERE ownerId = ?`,
+        WHERE ownerId = ? AND `+photoPublished,
 		userId,
 	).Scan(&count); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -93,14 +259,50 @@ func (db *appdbimpl) GetPhotoCount(userId uint) (uint, error) {
 	return count, nil
 }
 
-// UploadPhoto Upload a photo.
-func (db *appdbimpl) UploadPhoto(photo Photo) (Photo, error) {
-	uploadTime := time.Now().UTC().Format(time.RFC3339)
+/*
+UploadPhoto Upload a photo, along with the mentions of the given usernames in its caption.
+If the photo has a location, it is also indexed via its geohash.
+If the photo has a PublishAt time, it stays hidden until PublishDuePhotos publishes it.
+If the photo would exceed the quota of its owner, nothing is stored and a QuotaExceededError is returned.
+*/
+func (db *appdbimpl) UploadPhoto(photo Photo, quota Quota, mentions []string) (Photo, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return Photo{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
 
-	res, err := db.c.Exec(`
-        INSERT INTO Photos (ownerId, image, mimeType, caption, uploadTime, likeCount, commentsCount)
-        VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		photo.OwnerId, photo.Image, photo.MimeType, photo.Caption, uploadTime, photo.LikeCount, photo.CommentsCount,
+	photo, err = insertPhoto(tx, photo, quota, mentions)
+	if err != nil {
+		return Photo{}, err
+	}
+
+	return photo, tx.Commit()
+}
+
+/*
+insertPhoto Store a photo and its mentions inside a transaction, counting it in the storage usage of its owner, and in
+their photoCount field once published. The quota is checked first, see reserveStorage.
+*/
+func insertPhoto(tx *sql.Tx, photo Photo, quota Quota, mentions []string) (Photo, error) {
+	uploadTime := globaltime.Now().UTC().Format(time.RFC3339)
+
+	var geohash *string
+	if photo.Latitude != nil && photo.Longitude != nil {
+		hash := geo.Encode(geo.Point{Latitude: *photo.Latitude, Longitude: *photo.Longitude}, geo.Precision)
+		geohash = &hash
+	}
+
+	if err := reserveStorage(tx, photo.OwnerId, quota, int64(len(photo.Image)), 1, true); err != nil {
+		return Photo{}, err
+	}
+
+	res, err := tx.Exec(`
+        INSERT INTO Photos (ownerId, image, mimeType, caption, altText, uploadTime, likeCount, commentsCount, latitude, longitude, placeName, geohash, publishAt, sensitive, sensitiveReason, sensitiveBy, animated)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		photo.OwnerId, photo.Image, photo.MimeType, photo.Caption, photo.AltText, uploadTime, photo.LikeCount, photo.CommentsCount,
+		photo.Latitude, photo.Longitude, photo.PlaceName, geohash, photo.PublishAt, photo.Sensitive, photo.SensitiveReason, photo.SensitiveBy,
+		photo.Animated,
 	)
 	if err != nil {
 		return Photo{}, err
@@ -113,13 +315,200 @@ func (db *appdbimpl) UploadPhoto(photo Photo) (Photo, error) {
 
 	photo.PhotoId = uint(id)
 	photo.UploadTime = uploadTime
+	photo.Reactions = make(map[string]uint)
+
+	if photo.PublishAt == nil {
+		if err = addPhotoCount(tx, photo.OwnerId, 1); err != nil {
+			return Photo{}, err
+		}
+	}
+	if err = addMentions(tx, photo.PhotoId, 0, photo.OwnerId, mentions); err != nil {
+		return Photo{}, err
+	}
+
 	return photo, nil
 }
 
+/*
+GetScheduledPhotos Get the list of photos of a user waiting to be published.
+The photos are sorted by publishing time, from soonest to latest.
+*/
+func (db *appdbimpl) GetScheduledPhotos(userId uint) ([]Photo, error) {
+	return db.queryPhotos(
+		`SELECT `+photoColumns+`
+		FROM Photos
+		INNER JOIN Users ON Photos.ownerId = Users.userId
+		WHERE ownerId = ? AND publishAt IS NOT NULL
+		ORDER BY publishAt`,
+		userId,
+	)
+}
+
+/*
+PublishDuePhotos Publish all scheduled photos whose publishing time is not after `now`.
+A published photo takes its publishing time as upload time, so that it is placed in streams as if it was uploaded then.
+The returned photos are the ones published by this call.
+*/
+func (db *appdbimpl) PublishDuePhotos(now time.Time) ([]Photo, error) {
+	photos, err := db.queryPhotos(
+		`SELECT `+photoColumns+`
+		FROM Photos
+		INNER JOIN Users ON Photos.ownerId = Users.userId
+		WHERE publishAt IS NOT NULL AND publishAt <= ?
+		ORDER BY publishAt`,
+		now.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	published := make([]Photo, 0, len(photos))
+	for _, photo := range photos {
+		ok, err := db.publishPhoto(photo)
+		if err != nil {
+			return published, err
+		}
+
+		// Skip the photo if it was deleted or published in the meantime
+		if !ok {
+			continue
+		}
+
+		photo.UploadTime = *photo.PublishAt
+		photo.PublishAt = nil
+		published = append(published, photo)
+	}
+
+	return published, nil
+}
+
+/*
+publishPhoto Publish a scheduled photo, counting it in the photoCount field of its owner unless it is archived.
+Both happen in the same transaction, so that the count never misses a published photo.
+It returns false if the photo was not scheduled anymore.
+*/
+func (db *appdbimpl) publishPhoto(photo Photo) (bool, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.Exec(`
+        UPDATE Photos
+        SET uploadTime = publishAt, publishAt = NULL
+        WHERE photoId = ? AND publishAt IS NOT NULL`,
+		photo.PhotoId,
+	)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+
+	// The archived flag is read inside the transaction, as the photo may have been archived meanwhile
+	if _, err = tx.Exec(`
+        UPDATE Users
+        SET photoCount = photoCount + 1
+        WHERE userId = (SELECT ownerId FROM Photos WHERE photoId = ? AND archived = 0)`,
+		photo.PhotoId,
+	); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// SetPhotoAltText Replace the alt text of a photo.
+func (db *appdbimpl) SetPhotoAltText(photoId uint, altText string) error {
+	_, err := db.c.Exec(`
+        UPDATE Photos
+        SET altText = ?
+        WHERE photoId = ?`,
+		altText, photoId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetPhotoSensitive Mark a photo as sensitive media with the given reason, remembering who marked it.
+func (db *appdbimpl) SetPhotoSensitive(photoId uint, reason string, flaggedBy uint) error {
+	_, err := db.c.Exec(`
+        UPDATE Photos
+        SET sensitive = 1, sensitiveReason = ?, sensitiveBy = ?
+        WHERE photoId = ?`,
+		reason, flaggedBy, photoId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UnsetPhotoSensitive Remove the sensitive media mark from a photo.
+func (db *appdbimpl) UnsetPhotoSensitive(photoId uint) error {
+	_, err := db.c.Exec(`
+        UPDATE Photos
+        SET sensitive = 0, sensitiveReason = '', sensitiveBy = NULL
+        WHERE photoId = ?`,
+		photoId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+/*
+SearchPhotos Get the photos visible to a viewer whose alt text or caption contains the query, newest first.
+The search is case-insensitive for ASCII letters, and the query is matched literally.
+*/
+func (db *appdbimpl) SearchPhotos(query string, viewerId uint, limit uint) ([]Photo, error) {
+	// Escape the wildcards of LIKE, so that they are matched literally
+	pattern := "%" + likeEscaper.Replace(query) + "%"
+
+	return db.queryPhotos(
+		`SELECT `+photoColumns+`
+		FROM Photos
+		INNER JOIN Users ON Photos.ownerId = Users.userId
+		WHERE (Photos.altText LIKE ? ESCAPE '\' OR Photos.caption LIKE ? ESCAPE '\')
+		AND `+photoVisibleTo+`
+		ORDER BY Photos.uploadTime DESC
+		LIMIT ?`,
+		pattern, pattern, viewerId, limit,
+	)
+}
+
 // DeletePhoto Delete a photo and its associated comments.
 func (db *appdbimpl) DeletePhoto(photo Photo) error {
-	// Delete the comments associated with the photo
+	// Delete the reactions to the comments associated with the photo
 	_, err := db.c.Exec(`
+        DELETE FROM CommentReactions
+        WHERE commentId IN (SELECT commentId FROM Comments WHERE photoId = ?)`,
+		photo.PhotoId,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Delete the previous versions of the comments associated with the photo
+	_, err = db.c.Exec(`
+        DELETE FROM CommentVersions
+        WHERE commentId IN (SELECT commentId FROM Comments WHERE photoId = ?)`,
+		photo.PhotoId,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Delete the comments associated with the photo
+	_, err = db.c.Exec(`
         DELETE FROM Comments
         WHERE photoId = ?`,
 		photo.PhotoId,
@@ -128,6 +517,36 @@ func (db *appdbimpl) DeletePhoto(photo Photo) error {
 		return err
 	}
 
+	// Delete the mentions associated with the photo and its comments
+	_, err = db.c.Exec(`
+        DELETE FROM Mentions
+        WHERE photoId = ?`,
+		photo.PhotoId,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Delete the tags associated with the photo
+	_, err = db.c.Exec(`
+        DELETE FROM Tags
+        WHERE photoId = ?`,
+		photo.PhotoId,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Remove the photo from the collections it was saved in
+	_, err = db.c.Exec(`
+        DELETE FROM CollectionItems
+        WHERE photoId = ?`,
+		photo.PhotoId,
+	)
+	if err != nil {
+		return err
+	}
+
 	// Delete the likes associated with the photo
 	_, err = db.c.Exec(`
         DELETE FROM Likes
@@ -138,6 +557,30 @@ func (db *appdbimpl) DeletePhoto(photo Photo) error {
 		return err
 	}
 
+	// Delete the views of the photo
+	_, err = db.c.Exec(`
+        DELETE FROM PhotoViews
+        WHERE photoId = ?`,
+		photo.PhotoId,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Get the size of the photo, to remove it from the storage usage of the owner, and whether it was counted as published
+	var size int64
+	var published bool
+	err = db.c.QueryRow(`
+        SELECT length(image), `+photoPublished+` FROM Photos
+        WHERE photoId = ? AND ownerId = ?`,
+		photo.PhotoId, photo.OwnerId,
+	).Scan(&size, &published)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
 	// Delete the photo
 	_, err = db.c.Exec(`
         DELETE FROM Photos
@@ -148,5 +591,154 @@ func (db *appdbimpl) DeletePhoto(photo Photo) error {
 		return err
 	}
 
+	if published {
+		if err = addPhotoCount(db.c, photo.OwnerId, -1); err != nil {
+			return err
+		}
+	}
+	return addStorageUsage(db.c, photo.OwnerId, -size, -1)
+}
+
+/*
+markAnimatedPhotos Set the animated flag of the photos stored before it existed, checking their images.
+Only GIF and WebP images can be animated, so the other ones are skipped.
+*/
+func markAnimatedPhotos(db *sql.DB) error {
+	rows, err := db.Query(`
+        SELECT photoId FROM Photos
+        WHERE mimeType IN (?, ?)`,
+		imaging.GIF, imaging.WebP,
+	)
+	if err != nil {
+		return err
+	}
+	photoIds := make([]uint, 0)
+	for rows.Next() {
+		var photoId uint
+		if err = rows.Scan(&photoId); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		photoIds = append(photoIds, photoId)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	// Each image is read on its own, so that they are not all loaded at once
+	for _, photoId := range photoIds {
+		var image []byte
+		if err = db.QueryRow(`SELECT image FROM Photos WHERE photoId = ?`, photoId).Scan(&image); err != nil {
+			return err
+		}
+		if _, err = db.Exec(`
+            UPDATE Photos
+            SET animated = ?
+            WHERE photoId = ?`,
+			imaging.IsAnimated(image), photoId,
+		); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// addPhotoCount Add delta to the photoCount field of a user, counting their published photos.
+func addPhotoCount(ex execer, userId uint, delta int) error {
+	_, err := ex.Exec(`
+        UPDATE Users
+        SET photoCount = photoCount + ?
+        WHERE userId = ?`,
+		delta, userId,
+	)
+	return err
+}
+
+// geohashCondition returns a condition restricting the Photos to the ones whose geohash starts with any of the prefixes,
+// along with its parameters. Each prefix is matched via a range, so that the geohash index can be used.
+func geohashCondition(prefixes []string) (string, []interface{}) {
+	conditions := make([]string, 0, len(prefixes))
+	args := make([]interface{}, 0, 2*len(prefixes))
+	for _, prefix := range prefixes {
+		conditions = append(conditions, `(Photos.geohash >= ? AND Photos.geohash < ?)`)
+		// '{' is the character right after 'z', the last one of the geohash alphabet
+		args = append(args, prefix, prefix+"{")
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+/*
+GetPhotosInArea Get the list of photos taken inside an area, up to `limit` photos.
+Only the photos visible to the user with id `viewerId` are returned.
+The photos are sorted by date, from newest to oldest.
+*/
+func (db *appdbimpl) GetPhotosInArea(box geo.Box, viewerId uint, limit uint) ([]Photo, error) {
+	condition, args := geohashCondition(geo.Cover(box))
+	args = append(args, box.MinLatitude, box.MaxLatitude, box.MinLongitude, box.MaxLongitude, viewerId, limit)
+
+	return db.queryPhotos(
+		`SELECT `+photoColumns+`
+		FROM Photos
+		INNER JOIN Users ON Photos.ownerId = Users.userId
+		WHERE `+condition+`
+		AND Photos.latitude BETWEEN ? AND ?
+		AND Photos.longitude BETWEEN ? AND ?
+		AND `+photoVisibleTo+`
+		ORDER BY uploadTime DESC
+		LIMIT ?`,
+		args...,
+	)
+}
+
+/*
+GetPhotosNearby Get the list of photos taken within `radius` meters from a point, up to `limit` photos.
+Only the photos visible to the user with id `viewerId` are returned.
+The photos are sorted by distance, from nearest to farthest.
+*/
+func (db *appdbimpl) GetPhotosNearby(center geo.Point, radius float64, viewerId uint, limit uint) ([]Photo, error) {
+	box := geo.BoxAround(center, radius)
+	condition, args := geohashCondition(geo.Cover(box))
+
+	// Sort via the equirectangular approximation of the distance, good enough to rank the nearby photos:
+	// the photos in the corners of the box, outside the circle, are the last ones.
+	// The difference of the longitudes wraps around the antimeridian, where 179 and -179 are 2 degrees apart
+	cosLat := math.Cos(center.Latitude * math.Pi / 180)
+	args = append(args, box.MinLatitude, box.MaxLatitude, box.MinLongitude, box.MaxLongitude, viewerId,
+		center.Latitude, center.Latitude, center.Longitude, center.Longitude, center.Longitude, center.Longitude, cosLat*cosLat, limit)
+
+	// Keep only the photos inside the circle, the box also contains its corners.
+	// The candidates are read `limit` at a time, until enough of them are inside or there are no more
+	nearby := make([]Photo, 0)
+	for offset := uint(0); uint(len(nearby)) < limit; offset += limit {
+		photos, err := db.queryPhotos(
+			`SELECT `+photoColumns+`
+			FROM Photos
+			INNER JOIN Users ON Photos.ownerId = Users.userId
+			WHERE `+condition+`
+			AND Photos.latitude BETWEEN ? AND ?
+			AND Photos.longitude BETWEEN ? AND ?
+			AND `+photoVisibleTo+`
+			ORDER BY (Photos.latitude - ?) * (Photos.latitude - ?)
+				+ min(abs(Photos.longitude - ?), 360 - abs(Photos.longitude - ?))
+				* min(abs(Photos.longitude - ?), 360 - abs(Photos.longitude - ?)) * ?, Photos.photoId
+			LIMIT ? OFFSET ?`,
+			append(args, offset)...,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, photo := range photos {
+			location := geo.Point{Latitude: *photo.Latitude, Longitude: *photo.Longitude}
+			if geo.Distance(center, location) <= radius && uint(len(nearby)) < limit {
+				nearby = append(nearby, photo)
+			}
+		}
+		if uint(len(photos)) < limit {
+			break
+		}
+	}
+
+	return nearby, nil
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/globaltime"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+)
+
+// dayFormat is the layout of the days counted in DailyUploads.
+const dayFormat = "2006-01-02"
+
+// GetUserQuota Get the quota set for a user by an admin, or nil if the user has the default quota.
+func (db *appdbimpl) GetUserQuota(userId uint) (*Quota, error) {
+	var quota Quota
+	if err := db.c.QueryRow(`
+        SELECT maxBytes, maxPhotos, maxDailyBytes, maxDailyPhotos
+        FROM Quotas
+        WHERE userId = ?`,
+		userId,
+	).Scan(&quota.MaxBytes, &quota.MaxPhotos, &quota.MaxDailyBytes, &quota.MaxDailyPhotos); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// SetUserQuota Set the quota of a user, replacing the default one.
+func (db *appdbimpl) SetUserQuota(userId uint, quota Quota) error {
+	_, err := db.c.Exec(`
+        INSERT INTO Quotas (userId, maxBytes, maxPhotos, maxDailyBytes, maxDailyPhotos)
+        VALUES (?, ?, ?, ?, ?)
+        ON CONFLICT (userId) DO UPDATE SET
+            maxBytes = excluded.maxBytes,
+            maxPhotos = excluded.maxPhotos,
+            maxDailyBytes = excluded.maxDailyBytes,
+            maxDailyPhotos = excluded.maxDailyPhotos`,
+		userId, quota.MaxBytes, quota.MaxPhotos, quota.MaxDailyBytes, quota.MaxDailyPhotos,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteUserQuota Remove the quota set for a user, restoring the default one.
+func (db *appdbimpl) DeleteUserQuota(userId uint) error {
+	_, err := db.c.Exec(`
+        DELETE FROM Quotas
+        WHERE userId = ?`,
+		userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+/*
+storageUsageColumns selects the storage used by a user, in total and today.
+The id of the user must be bound to its parameters, along with the current day for the daily ones.
+If the usage of the user is not tracked yet, as for the users who uploaded photos before quotas existed, it is
+computed from their photos, stories and open uploads as done by trackStorageUsage.
+*/
+const storageUsageColumns = `
+	COALESCE((SELECT bytes FROM StorageUsage WHERE userId = ?), (` + untrackedBytes + `)),
+	COALESCE((SELECT photos FROM StorageUsage WHERE userId = ?), (SELECT COUNT(*) FROM Photos WHERE ownerId = ?)),
+	COALESCE((SELECT bytes FROM DailyUploads WHERE userId = ? AND day = ?), 0),
+	COALESCE((SELECT photos FROM DailyUploads WHERE userId = ? AND day = ?), 0)`
+
+/*
+untrackedBytes computes the bytes used by a user whose usage is not tracked yet: the size of their photos and stories,
+and the length of their open uploads. The id of the user must be bound to all its parameters.
+*/
+const untrackedBytes = `SELECT COALESCE((SELECT SUM(length(image)) FROM Photos WHERE ownerId = ?), 0)
+	+ COALESCE((SELECT SUM(length(image)) FROM Stories WHERE ownerId = ?), 0)
+	+ COALESCE((SELECT SUM(uploadLength) FROM Uploads WHERE ownerId = ? AND ` + uploadOpen + `), 0)`
+
+/*
+GetStorageUsage Get the storage used by a user, in total and today.
+The quota of the returned usage is left empty, as the default one is not known to the db.
+*/
+func (db *appdbimpl) GetStorageUsage(userId uint) (StorageUsage, error) {
+	return getStorageUsage(db.c, userId)
+}
+
+// getStorageUsage Get the storage used by a user, in total and today, inside a transaction or not.
+func getStorageUsage(q queryer, userId uint) (StorageUsage, error) {
+	var usage StorageUsage
+	today := globaltime.Now().UTC().Format(dayFormat)
+	if err := q.QueryRow(`SELECT `+storageUsageColumns,
+		userId, userId, userId, userId, userId, userId, userId, today, userId, today,
+	).Scan(&usage.Bytes, &usage.Photos, &usage.DailyBytes, &usage.DailyPhotos); err != nil {
+		return StorageUsage{}, err
+	}
+	return usage, nil
+}
+
+/*
+trackStorageUsage Start tracking the storage usage of a user, computing it from their photos, stories and open uploads.
+It does nothing if the usage is already tracked.
+*/
+func trackStorageUsage(ex execer, userId uint) error {
+	_, err := ex.Exec(`
+        INSERT OR IGNORE INTO StorageUsage (userId, bytes, photos)
+        SELECT ?, (`+untrackedBytes+`), (SELECT COUNT(*) FROM Photos WHERE ownerId = ?)`,
+		userId, userId, userId, userId, userId,
+	)
+	return err
+}
+
+/*
+addStorageUsage Add the given amounts to the storage usage of a user, they are negative when photos are deleted.
+If the usage of the user is not tracked yet, it is computed from their photos, stories and open uploads, which already
+include the change.
+*/
+func addStorageUsage(ex execer, userId uint, bytes int64, photos int64) error {
+	res, err := ex.Exec(`
+        UPDATE StorageUsage
+        SET bytes = bytes + ?, photos = photos + ?
+        WHERE userId = ?`,
+		bytes, photos, userId,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil || affected > 0 {
+		return err
+	}
+
+	return trackStorageUsage(ex, userId)
+}
+
+/*
+reserveStorage Add the given amounts to the storage usage of a user, unless they would exceed their quota, in which
+case it returns a QuotaExceededError. Only the photos and stories being posted, not the uploads still open, count
+against the daily limits, which is what `daily` is for.
+It must run inside a transaction: the conditional update of the usage takes the write lock of the db, so that
+concurrent uploads are checked one after the other and cannot exceed the quota together.
+*/
+func reserveStorage(tx *sql.Tx, userId uint, quota Quota, bytes int64, photos int64, daily bool) error {
+	if err := trackStorageUsage(tx, userId); err != nil {
+		return err
+	}
+
+	// Add the amounts only if they fit in the total limits, a limit of 0 means unlimited
+	res, err := tx.Exec(`
+        UPDATE StorageUsage
+        SET bytes = bytes + ?, photos = photos + ?
+        WHERE userId = ?
+            AND (? <= 0 OR ? <= 0 OR bytes + ? <= ?)
+            AND (? <= 0 OR ? <= 0 OR photos + ? <= ?)`,
+		bytes, photos, userId,
+		quota.MaxBytes, bytes, bytes, quota.MaxBytes,
+		quota.MaxPhotos, photos, photos, quota.MaxPhotos,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		usage, err := getStorageUsage(tx, userId)
+		if err != nil {
+			return err
+		}
+		return exceededLimit([]QuotaExceededError{
+			{Limit: "maxBytes", Max: quota.MaxBytes, Used: usage.Bytes, Requested: bytes},
+			{Limit: "maxPhotos", Max: quota.MaxPhotos, Used: usage.Photos, Requested: photos},
+		})
+	}
+	if !daily {
+		return nil
+	}
+
+	// Check the daily limits, the write lock is already held, and forget the uploads of the previous days
+	today := globaltime.Now().UTC().Format(dayFormat)
+	if _, err = tx.Exec(`
+        DELETE FROM DailyUploads
+        WHERE userId = ? AND day < ?`,
+		userId, today,
+	); err != nil {
+		return err
+	}
+	usage, err := getStorageUsage(tx, userId)
+	if err != nil {
+		return err
+	}
+	if err = exceededLimit([]QuotaExceededError{
+		{Limit: "maxDailyBytes", Max: quota.MaxDailyBytes, Used: usage.DailyBytes, Requested: bytes},
+		{Limit: "maxDailyPhotos", Max: quota.MaxDailyPhotos, Used: usage.DailyPhotos, Requested: photos},
+	}); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO DailyUploads (userId, day, bytes, photos)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT (userId, day) DO UPDATE SET
+            bytes = bytes + excluded.bytes,
+            photos = photos + excluded.photos`,
+		userId, today, bytes, photos,
+	)
+	return err
+}
+
+// exceededLimit returns the first of the given limits exceeded by the amount requested, or nil if none is.
+func exceededLimit(limits []QuotaExceededError) error {
+	for i := range limits {
+		limit := &limits[i]
+		if limit.Max > 0 && limit.Requested > 0 && limit.Used+limit.Requested > limit.Max {
+			return limit
+		}
+	}
+	return nil
+}
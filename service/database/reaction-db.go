@@ -0,0 +1,143 @@
+package database
+
+import (
+	"encoding/json"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+)
+
+/*
+ReplaceUnknownReactions Replace the stored reactions to photos and comments that are not among `reactions` with the
+first one, the like, so that they can still be changed and removed once the available reactions are reconfigured.
+It returns how many reactions were replaced.
+*/
+func (db *appdbimpl) ReplaceUnknownReactions(reactions []string) (int64, error) {
+	available, err := json.Marshal(reactions)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var replaced int64
+	for _, table := range []string{"Likes", "CommentReactions"} {
+		res, err := tx.Exec(`
+            UPDATE `+table+`
+            SET reaction = ?
+            WHERE reaction NOT IN (SELECT value FROM json_each(?))`,
+			reactions[0], string(available),
+		)
+		if err != nil {
+			return 0, err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		replaced += affected
+	}
+
+	return replaced, tx.Commit()
+}
+
+// ReactToComment Add the reaction of a user to a comment, replacing their previous one.
+func (db *appdbimpl) ReactToComment(commentId uint, userId uint, reaction string) error {
+	_, err := db.c.Exec(`
+        INSERT INTO CommentReactions (commentId, userId, reaction)
+        VALUES (?, ?, ?)
+        ON CONFLICT (commentId, userId) DO UPDATE SET reaction = excluded.reaction`,
+		commentId, userId, reaction,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UnreactToComment Remove the reaction of a user to a comment.
+func (db *appdbimpl) UnreactToComment(commentId uint, userId uint) error {
+	_, err := db.c.Exec(`
+        DELETE FROM CommentReactions
+        WHERE commentId = ? AND userId = ?`,
+		commentId, userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+/*
+addCommentReactions fills the Reactions and MyReaction fields of the given comments, as seen by a viewer.
+The condition selects the reactions to load, with its args bound after the id of the viewer.
+*/
+func (db *appdbimpl) addCommentReactions(comments []Comment, viewerId uint, condition string, args ...interface{}) error {
+	rows, err := db.c.Query(`
+        SELECT commentId, reaction, COUNT(*), MAX(userId = ?)
+        FROM CommentReactions
+        WHERE `+condition+`
+        GROUP BY commentId, reaction`,
+		append([]interface{}{viewerId}, args...)...,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	counts := make(map[uint]map[string]uint)
+	mine := make(map[uint]string)
+	for rows.Next() {
+		var commentId, count uint
+		var reaction string
+		var byViewer bool
+		if err = rows.Scan(&commentId, &reaction, &count, &byViewer); err != nil {
+			return err
+		}
+		if counts[commentId] == nil {
+			counts[commentId] = make(map[string]uint)
+		}
+		counts[commentId][reaction] = count
+		if byViewer {
+			mine[commentId] = reaction
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range comments {
+		comments[i].Reactions = counts[comments[i].CommentId]
+		if comments[i].Reactions == nil {
+			comments[i].Reactions = make(map[string]uint)
+		}
+		comments[i].MyReaction = mine[comments[i].CommentId]
+	}
+
+	return nil
+}
+
+/*
+DeleteCommentReactionsByBannedUser Remove all reactions of a banned user to the comments under the photos of the
+requester, and to the comments of the requester.
+*/
+func (db *appdbimpl) DeleteCommentReactionsByBannedUser(userId uint, bannedUserId uint) error {
+	_, err := db.c.Exec(`
+        DELETE FROM CommentReactions
+        WHERE userId = ? AND commentId IN (
+            SELECT commentId FROM Comments
+            WHERE ownerId = ? OR photoId IN (SELECT photoId FROM Photos WHERE ownerId = ?)
+        )`,
+		bannedUserId, userId, userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
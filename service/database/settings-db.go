@@ -0,0 +1,48 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+)
+
+// defaultSettings are the settings of the users who never changed them, matching the defaults of the Settings table.
+var defaultSettings = Settings{SensitiveMedia: "blur"}
+
+/*
+GetSettings Get the settings of a user.
+Users who never changed them have no row in the Settings table, and get the defaults.
+*/
+func (db *appdbimpl) GetSettings(userId uint) (Settings, error) {
+	var settings Settings
+
+	if err := db.c.QueryRow(`
+        SELECT sensitiveMedia
+        FROM Settings
+        WHERE userId = ?`,
+		userId,
+	).Scan(&settings.SensitiveMedia); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return defaultSettings, nil
+		}
+		return Settings{}, err
+	}
+
+	return settings, nil
+}
+
+// SetSettings Replace the settings of a user.
+func (db *appdbimpl) SetSettings(userId uint, settings Settings) error {
+	_, err := db.c.Exec(`
+        INSERT INTO Settings (userId, sensitiveMedia)
+        VALUES (?, ?)
+        ON CONFLICT (userId) DO UPDATE SET
+            sensitiveMedia = excluded.sensitiveMedia`,
+		userId, settings.SensitiveMedia,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
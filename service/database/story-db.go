@@ -0,0 +1,307 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/globaltime"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"time"
+)
+
+/*
+storyColumns is the list of columns selected whenever a Story is read from the database.
+The id of the viewer must be bound to its only parameter, to know if they have seen the story.
+The order of the columns must match the one expected by scanStory.
+*/
+const storyColumns = `Stories.storyId, Stories.ownerId, Users.username, Stories.image, Stories.mimeType, Stories.caption, Stories.createdAt, Stories.expiresAt,
+	EXISTS (SELECT 1 FROM StoryViews WHERE StoryViews.storyId = Stories.storyId AND StoryViews.userId = ?)`
+
+/*
+storyListColumns is like storyColumns, but it leaves out the image of the stories, which lists fetch separately from
+the image endpoint instead of loading every image at once.
+*/
+const storyListColumns = `Stories.storyId, Stories.ownerId, Users.username, NULL, Stories.mimeType, Stories.caption, Stories.createdAt, Stories.expiresAt,
+	EXISTS (SELECT 1 FROM StoryViews WHERE StoryViews.storyId = Stories.storyId AND StoryViews.userId = ?)`
+
+// scanStory scans a row selected via storyColumns or storyListColumns into a Story.
+func scanStory(row rowScanner) (Story, error) {
+	var story Story
+	err := row.Scan(
+		&story.StoryId,
+		&story.OwnerId,
+		&story.OwnerUsername,
+		&story.Image,
+		&story.MimeType,
+		&story.Caption,
+		&story.CreatedAt,
+		&story.ExpiresAt,
+		&story.Seen,
+	)
+	return story, err
+}
+
+// queryStories runs a query selecting storyListColumns and returns the resulting list of stories.
+func (db *appdbimpl) queryStories(query string, args ...interface{}) ([]Story, error) {
+	rows, err := db.c.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	stories := make([]Story, 0)
+	for rows.Next() {
+		story, err := scanStory(rows)
+		if err != nil {
+			return nil, err
+		}
+		stories = append(stories, story)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stories, nil
+}
+
+/*
+CreateStory Post a new story, its CreatedAt and ExpiresAt must already be set.
+Its image is counted in the storage usage of its owner, unless it would exceed their quota, in which case a
+QuotaExceededError is returned. Stories are not photos, so they only count against the limits on bytes.
+*/
+func (db *appdbimpl) CreateStory(story Story, quota Quota) (Story, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return Story{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err = reserveStorage(tx, story.OwnerId, quota, int64(len(story.Image)), 0, true); err != nil {
+		return Story{}, err
+	}
+
+	res, err := tx.Exec(`
+        INSERT INTO Stories (ownerId, image, mimeType, caption, createdAt, expiresAt)
+        VALUES (?, ?, ?, ?, ?, ?)`,
+		story.OwnerId, story.Image, story.MimeType, story.Caption, story.CreatedAt, story.ExpiresAt,
+	)
+	if err != nil {
+		return Story{}, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Story{}, err
+	}
+	story.StoryId = uint(id)
+
+	return story, tx.Commit()
+}
+
+// GetStory Get a story not yet expired at the given time, as seen by a viewer, including its image.
+func (db *appdbimpl) GetStory(storyId uint, viewerId uint, now time.Time) (Story, error) {
+	story, err := scanStory(db.c.QueryRow(
+		`SELECT `+storyColumns+`
+		FROM Stories
+		INNER JOIN Users ON Stories.ownerId = Users.userId
+		WHERE Stories.storyId = ? AND Stories.expiresAt > ?`,
+		viewerId, storyId, now.UTC().Format(time.RFC3339),
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Story{}, &StoryNotFoundError{StoryId: storyId}
+		}
+		return Story{}, err
+	}
+	return story, nil
+}
+
+/*
+GetUserStories Get the stories of a user not yet expired at the given time, from oldest to newest.
+Their images are left out, see storyListColumns.
+*/
+func (db *appdbimpl) GetUserStories(ownerId uint, viewerId uint, now time.Time) ([]Story, error) {
+	return db.queryStories(
+		`SELECT `+storyListColumns+`
+		FROM Stories
+		INNER JOIN Users ON Stories.ownerId = Users.userId
+		WHERE Stories.ownerId = ? AND Stories.expiresAt > ?
+		ORDER BY Stories.createdAt, Stories.storyId`,
+		viewerId, ownerId, now.UTC().Format(time.RFC3339),
+	)
+}
+
+/*
+GetFollowedStories Get the stories not yet expired at the given time of the users followed by a viewer.
+Users who banned the viewer are excluded. The stories are sorted by owner, and from oldest to newest.
+Their images are left out, see storyListColumns.
+*/
+func (db *appdbimpl) GetFollowedStories(viewerId uint, now time.Time) ([]Story, error) {
+	return db.queryStories(
+		`SELECT `+storyListColumns+`
+		FROM Stories
+		INNER JOIN Users ON Stories.ownerId = Users.userId
+		INNER JOIN Followers ON Followers.followingUserId = Stories.ownerId AND Followers.followerUserId = ?
+		WHERE Stories.expiresAt > ?
+		AND Stories.ownerId NOT IN (SELECT userId FROM Bans WHERE bannedUserId = ?)
+		ORDER BY Users.username, Stories.createdAt, Stories.storyId`,
+		viewerId, viewerId, now.UTC().Format(time.RFC3339), viewerId,
+	)
+}
+
+// DeleteStory Delete a story of a user, along with its views, releasing the storage used by its image.
+func (db *appdbimpl) DeleteStory(storyId uint, ownerId uint) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Delete the views first, which takes the write lock, so that the story cannot be released twice
+	_, err = tx.Exec(`
+        DELETE FROM StoryViews
+        WHERE storyId IN (SELECT storyId FROM Stories WHERE storyId = ? AND ownerId = ?)`,
+		storyId, ownerId,
+	)
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	if err = tx.QueryRow(`
+        SELECT length(image) FROM Stories
+        WHERE storyId = ? AND ownerId = ?`,
+		storyId, ownerId,
+	).Scan(&size); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	_, err = tx.Exec(`
+        DELETE FROM Stories
+        WHERE storyId = ? AND ownerId = ?`,
+		storyId, ownerId,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err = addStorageUsage(tx, ownerId, -size, 0); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MarkStorySeen Record that a user has seen a story, keeping the time of the first view.
+func (db *appdbimpl) MarkStorySeen(storyId uint, userId uint) error {
+	_, err := db.c.Exec(`
+        INSERT OR IGNORE INTO StoryViews (storyId, userId, seenAt)
+        VALUES (?, ?, ?)`,
+		storyId, userId, globaltime.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetStoryViews Get the users who have seen a story, from the first to the last one.
+func (db *appdbimpl) GetStoryViews(storyId uint) ([]StoryView, error) {
+	rows, err := db.c.Query(`
+        SELECT StoryViews.userId, Users.username, StoryViews.seenAt
+        FROM StoryViews
+        INNER JOIN Users ON StoryViews.userId = Users.userId
+        WHERE StoryViews.storyId = ?
+        ORDER BY StoryViews.seenAt, StoryViews.userId`,
+		storyId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	views := make([]StoryView, 0)
+	for rows.Next() {
+		var view StoryView
+		if err = rows.Scan(&view.UserId, &view.Username, &view.SeenAt); err != nil {
+			return nil, err
+		}
+		views = append(views, view)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return views, nil
+}
+
+/*
+DeleteExpiredStories Delete the stories expired at the given time, along with their images and views, releasing the
+storage used by their images.
+*/
+func (db *appdbimpl) DeleteExpiredStories(now time.Time) (int64, error) {
+	expired := now.UTC().Format(time.RFC3339)
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Release the storage first, the users whose usage is not tracked yet will not count the stories once deleted
+	_, err = tx.Exec(`
+        UPDATE StorageUsage
+        SET bytes = bytes - (
+            SELECT COALESCE(SUM(length(Stories.image)), 0) FROM Stories
+            WHERE Stories.ownerId = StorageUsage.userId AND Stories.expiresAt <= ?
+        )
+        WHERE userId IN (SELECT ownerId FROM Stories WHERE expiresAt <= ?)`,
+		expired, expired,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+        DELETE FROM StoryViews
+        WHERE storyId IN (SELECT storyId FROM Stories WHERE expiresAt <= ?)`,
+		expired,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(`
+        DELETE FROM Stories
+        WHERE expiresAt <= ?`,
+		expired,
+	)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, tx.Commit()
+}
+
+// DeleteStoryViewsByBannedUser Remove a banned user from the viewers of the stories of the user who banned them.
+func (db *appdbimpl) DeleteStoryViewsByBannedUser(userId uint, bannedUserId uint) error {
+	_, err := db.c.Exec(`
+        DELETE FROM StoryViews
+        WHERE userId = ? AND storyId IN (SELECT storyId FROM Stories WHERE ownerId = ?)`,
+		bannedUserId, userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
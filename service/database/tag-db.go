@@ -0,0 +1,112 @@
+package database
+
+import . "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+
+// GetPhotoTags Get all users tagged in a photo.
+func (db *appdbimpl) GetPhotoTags(photoId uint) ([]Tag, error) {
+	rows, err := db.c.Query(`
+        SELECT Tags.photoId, Tags.taggedUserId, Users.username, Tags.x, Tags.y
+        FROM Tags
+        INNER JOIN Users ON Tags.taggedUserId = Users.userId
+        WHERE Tags.photoId = ?`,
+		photoId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	tags := make([]Tag, 0)
+	for rows.Next() {
+		var tag Tag
+		if err = rows.Scan(&tag.PhotoId, &tag.UserId, &tag.Username, &tag.X, &tag.Y); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+/*
+GetTaggedPhotos Get the list of photos in which a user was tagged.
+Only the photos visible to the user with id `viewerId` are returned.
+The photos are sorted by date, from newest to oldest.
+*/
+func (db *appdbimpl) GetTaggedPhotos(userId uint, viewerId uint) ([]Photo, error) {
+	return db.queryPhotos(
+		`SELECT `+photoColumns+`
+		FROM Photos
+		INNER JOIN Users ON Photos.ownerId = Users.userId
+		WHERE Photos.photoId IN (
+			SELECT photoId FROM Tags WHERE taggedUserId = ?
+		) AND `+photoVisibleTo+`
+		ORDER BY uploadTime DESC`,
+		userId, viewerId,
+	)
+}
+
+/*
+TagUser Tag a user in a photo at the given position.
+If the user was already tagged in the photo, the tag is moved to the new position.
+*/
+func (db *appdbimpl) TagUser(tag Tag) error {
+	_, err := db.c.Exec(`
+        INSERT INTO Tags (photoId, taggedUserId, x, y)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT (photoId, taggedUserId) DO UPDATE SET x = excluded.x, y = excluded.y`,
+		tag.PhotoId, tag.UserId, tag.X, tag.Y,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UntagUser Remove the tag of a user from a photo.
+func (db *appdbimpl) UntagUser(photoId uint, userId uint) error {
+	res, err := db.c.Exec(`
+        DELETE FROM Tags
+        WHERE photoId = ? AND taggedUserId = ?`,
+		photoId, userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return &TagNotFoundError{PhotoId: photoId, UserId: userId}
+	}
+
+	return nil
+}
+
+/*
+DeleteTagsByBannedUser Remove all tags between the requester and a banned user.
+That is, the tags of the banned user in the photos of the requester, and vice versa.
+*/
+func (db *appdbimpl) DeleteTagsByBannedUser(userId uint, bannedUserId uint) error {
+	_, err := db.c.Exec(`
+        DELETE FROM Tags
+        WHERE (taggedUserId = ? AND photoId IN (
+            SELECT photoId FROM Photos WHERE ownerId = ?
+        )) OR (taggedUserId = ? AND photoId IN (
+            SELECT photoId FROM Photos WHERE ownerId = ?
+        ))`,
+		bannedUserId, userId, userId, bannedUserId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
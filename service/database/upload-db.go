@@ -0,0 +1,373 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/globaltime"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	"github.com/gofrs/uuid"
+	"time"
+)
+
+/*
+uploadOpen is a condition restricting the Uploads to the ones whose photo is not created yet, including the claimed
+ones. Their length is counted in the storage usage of their owner until they are finished or deleted.
+*/
+const uploadOpen = `(Uploads.photoId IS NULL OR Uploads.photoId = 0)`
+
+/*
+CreateUpload Create a new empty resumable upload, with a random id.
+Its length is counted in the storage usage of its owner, unless it would exceed their quota, in which case a
+QuotaExceededError is returned. If the owner already has `maxOpen` open uploads, a TooManyUploadsError is returned.
+*/
+func (db *appdbimpl) CreateUpload(upload Upload, quota Quota, maxOpen int) (Upload, error) {
+	uploadId, err := uuid.NewV4()
+	if err != nil {
+		return Upload{}, err
+	}
+	createdAt := globaltime.Now().UTC().Format(time.RFC3339)
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return Upload{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Reserve the storage first, which takes the write lock, so that concurrent uploads are counted one at a time
+	if err = reserveStorage(tx, upload.OwnerId, quota, upload.Length, 0, false); err != nil {
+		return Upload{}, err
+	}
+
+	var open int
+	if err = tx.QueryRow(`
+        SELECT COUNT(*) FROM Uploads
+        WHERE ownerId = ? AND `+uploadOpen,
+		upload.OwnerId,
+	).Scan(&open); err != nil {
+		return Upload{}, err
+	}
+	if open >= maxOpen {
+		return Upload{}, &TooManyUploadsError{Max: maxOpen}
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO Uploads (uploadId, ownerId, uploadLength, uploadOffset, metadata, createdAt)
+        VALUES (?, ?, ?, 0, ?, ?)`,
+		uploadId.String(), upload.OwnerId, upload.Length, upload.Metadata, createdAt,
+	)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Upload{}, err
+	}
+
+	upload.UploadId = uploadId.String()
+	upload.Offset = 0
+	upload.CreatedAt = createdAt
+	upload.PhotoId = nil
+	return upload, nil
+}
+
+/*
+GetUpload Get a resumable upload by its id.
+Uploads are private, so it is only found if it belongs to the user with id `ownerId`.
+*/
+func (db *appdbimpl) GetUpload(uploadId string, ownerId uint) (Upload, error) {
+	var upload Upload
+	if err := db.c.QueryRow(`
+        SELECT uploadId, ownerId, uploadLength, uploadOffset, metadata, createdAt, NULLIF(photoId, 0)
+        FROM Uploads
+        WHERE uploadId = ? AND ownerId = ?`,
+		uploadId, ownerId,
+	).Scan(
+		&upload.UploadId,
+		&upload.OwnerId,
+		&upload.Length,
+		&upload.Offset,
+		&upload.Metadata,
+		&upload.CreatedAt,
+		&upload.PhotoId,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Upload{}, &UploadNotFoundError{UploadId: uploadId}
+		}
+		return Upload{}, err
+	}
+	return upload, nil
+}
+
+/*
+AppendUploadChunk Store a chunk of data at the current offset of an upload, and advance the offset.
+If another chunk was stored at the same offset in the meantime, nothing is stored and an UploadOffsetMismatchError is
+returned.
+*/
+func (db *appdbimpl) AppendUploadChunk(upload Upload, data []byte) (Upload, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return Upload{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Advance the offset, only if it did not change since the upload was read
+	res, err := tx.Exec(`
+        UPDATE Uploads
+        SET uploadOffset = uploadOffset + ?
+        WHERE uploadId = ? AND uploadOffset = ?`,
+		len(data), upload.UploadId, upload.Offset,
+	)
+	if err != nil {
+		return Upload{}, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return Upload{}, err
+	}
+	if affected == 0 {
+		return Upload{}, &UploadOffsetMismatchError{Offset: upload.Offset}
+	}
+
+	// Store the chunk
+	_, err = tx.Exec(`
+        INSERT INTO UploadChunks (uploadId, chunkOffset, data)
+        VALUES (?, ?, ?)`,
+		upload.UploadId, upload.Offset, data,
+	)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Upload{}, err
+	}
+
+	upload.Offset += int64(len(data))
+	return upload, nil
+}
+
+// GetUploadData Get the data received so far by an upload, joining its chunks.
+func (db *appdbimpl) GetUploadData(uploadId string) ([]byte, error) {
+	rows, err := db.c.Query(`
+        SELECT data
+        FROM UploadChunks
+        WHERE uploadId = ?
+        ORDER BY chunkOffset`,
+		uploadId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var data bytes.Buffer
+	for rows.Next() {
+		var chunk []byte
+		if err = rows.Scan(&chunk); err != nil {
+			return nil, err
+		}
+		data.Write(chunk)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return data.Bytes(), nil
+}
+
+/*
+ClaimUpload Claim a complete upload to create its photo, so that no other request creates it too.
+A claimed upload has 0 as photoId until FinishUpload links it to the photo, and it is read as not finished yet.
+It returns false if the upload was already claimed.
+*/
+func (db *appdbimpl) ClaimUpload(uploadId string) (bool, error) {
+	res, err := db.c.Exec(`
+        UPDATE Uploads
+        SET photoId = 0
+        WHERE uploadId = ? AND photoId IS NULL AND uploadOffset = uploadLength`,
+		uploadId,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// ReleaseUpload Release the claim on an upload whose photo could not be created, so that it can be claimed again.
+func (db *appdbimpl) ReleaseUpload(uploadId string) error {
+	_, err := db.c.Exec(`
+        UPDATE Uploads
+        SET photoId = NULL
+        WHERE uploadId = ? AND photoId = 0`,
+		uploadId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+/*
+FinishUpload Create the photo of an upload claimed via ClaimUpload, along with the mentions of the given usernames in
+its caption, and link the upload to it. The length of the upload is replaced by the photo in the storage usage of the
+owner, and if the photo would exceed their quota nothing is stored and a QuotaExceededError is returned.
+The chunks are no longer needed and are deleted, while the upload is kept until it expires so that clients can still
+query it. Everything happens in the same transaction, so that an upload is never left claimed with its photo created.
+*/
+func (db *appdbimpl) FinishUpload(upload Upload, photo Photo, quota Quota, mentions []string) (Photo, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return Photo{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Release the storage reserved for the upload, before counting the photo.
+	// The usage is tracked first, otherwise it would be computed with the upload, which is still open
+	if err = trackStorageUsage(tx, upload.OwnerId); err != nil {
+		return Photo{}, err
+	}
+	if err = addStorageUsage(tx, upload.OwnerId, -upload.Length, 0); err != nil {
+		return Photo{}, err
+	}
+	photo, err = insertPhoto(tx, photo, quota, mentions)
+	if err != nil {
+		return Photo{}, err
+	}
+
+	res, err := tx.Exec(`
+        UPDATE Uploads
+        SET photoId = ?
+        WHERE uploadId = ? AND photoId = 0`,
+		photo.PhotoId, upload.UploadId,
+	)
+	if err != nil {
+		return Photo{}, err
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return Photo{}, err
+	} else if affected == 0 {
+		return Photo{}, &UploadNotFoundError{UploadId: upload.UploadId}
+	}
+
+	_, err = tx.Exec(`
+        DELETE FROM UploadChunks
+        WHERE uploadId = ?`,
+		upload.UploadId,
+	)
+	if err != nil {
+		return Photo{}, err
+	}
+
+	return photo, tx.Commit()
+}
+
+/*
+DeleteUpload Delete an upload and its chunks.
+If it was still open, its length is no longer counted in the storage usage of its owner.
+*/
+func (db *appdbimpl) DeleteUpload(upload Upload) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(`
+        DELETE FROM UploadChunks
+        WHERE uploadId = ?`,
+		upload.UploadId,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Check if the upload is still open, after the first write so that the write lock is held
+	var open bool
+	if err = tx.QueryRow(`
+        SELECT `+uploadOpen+` FROM Uploads
+        WHERE uploadId = ?`,
+		upload.UploadId,
+	).Scan(&open); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	_, err = tx.Exec(`
+        DELETE FROM Uploads
+        WHERE uploadId = ?`,
+		upload.UploadId,
+	)
+	if err != nil {
+		return err
+	}
+
+	// A finished upload no longer counts, its photo does instead and it is kept
+	if open {
+		if err = addStorageUsage(tx, upload.OwnerId, -upload.Length, 0); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+/*
+DeleteExpiredUploads Delete all uploads created before the given time, along with their chunks.
+The length of the ones still open is no longer counted in the storage usage of their owners.
+*/
+func (db *appdbimpl) DeleteExpiredUploads(createdBefore time.Time) (int64, error) {
+	before := createdBefore.UTC().Format(time.RFC3339)
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(`
+        UPDATE StorageUsage
+        SET bytes = bytes - (
+            SELECT COALESCE(SUM(uploadLength), 0) FROM Uploads
+            WHERE Uploads.ownerId = StorageUsage.userId AND Uploads.createdAt < ? AND `+uploadOpen+`
+        )
+        WHERE userId IN (SELECT ownerId FROM Uploads WHERE createdAt < ? AND `+uploadOpen+`)`,
+		before, before,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+        DELETE FROM UploadChunks
+        WHERE uploadId IN (SELECT uploadId FROM Uploads WHERE createdAt < ?)`,
+		before,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(`
+        DELETE FROM Uploads
+        WHERE createdAt < ?`,
+		before,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return deleted, tx.Commit()
+}
@@ -4,7 +4,6 @@ import (
 	"database/sql"
 	"errors"
 	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
-	"sort"
 	"strings"
 )
 
@@ -34,33 +33,85 @@ func (db *appdbimpl) CreateUser(user User) (User, error) {
 	return user, nil
 }
 
-// GetAllUsers retrieves all users from the database via paginated requests.
-func (db *appdbimpl) GetAllUsers(page int, pageSize int) ([]User, error) {
-	offset := (page - 1) * pageSize
+/*
+GetAllUsers retrieves a page of the list of the users matching a search from the database, in the order it requests.
+The ties are broken by join date, in the same direction.
+The cursor records the order of its page, so it is an InvalidCursorError to reuse it with a different one.
+
+Every filter and order is backed by an index: the prefixes are matched via a range on the usernames, ignoring case,
+and the users are sorted by the followersCount and photoCount counters, kept up to date by the db.
+Only the substrings need to scan the usernames.
+*/
+func (db *appdbimpl) GetAllUsers(search UserSearch, cursor string, limit int) ([]User, string, error) {
+	// The counter the users are sorted by, the users who joined first come first by default
+	sortKey, order, after := "Users.userId", "ASC", ">"
+	switch search.Sort {
+	case UserSortFollowers:
+		sortKey, order, after = "Users.followersCount", "DESC", "<"
+	case UserSortPhotos:
+		sortKey, order, after = "Users.photoCount", "DESC", "<"
+	}
+
+	conditions := []string{"1"}
+	args := make([]interface{}, 0)
+	if search.Query != "" && search.Substring {
+		conditions = append(conditions, `Users.username LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(search.Query)+"%")
+	} else if search.Query != "" {
+		// `~` sorts after every character allowed in a username
+		conditions = append(conditions, `Users.username >= ? COLLATE NOCASE AND Users.username < ? COLLATE NOCASE`)
+		args = append(args, search.Query, search.Query+"~")
+	}
+	if search.FollowedBy != 0 {
+		conditions = append(conditions, `Users.userId IN (SELECT followingUserId FROM Followers WHERE followerUserId = ?)`)
+		args = append(args, search.FollowedBy)
+	}
+	if cursor != "" {
+		var sort string
+		var key, afterId uint
+		if err := decodeCursor(cursor, &sort, &key, &afterId); err != nil {
+			return nil, "", err
+		}
+		if sort != search.Sort {
+			return nil, "", &InvalidCursorError{Cursor: cursor}
+		}
+		conditions = append(conditions, `(`+sortKey+`, Users.userId) `+after+` (?, ?)`)
+		args = append(args, key, afterId)
+	}
+
 	rows, err := db.c.Query(`
-        SELECT userId, username FROM Users
-        LIMIT ? OFFSET ?`,
-		pageSize, offset,
+        SELECT Users.userId, Users.username, `+sortKey+` FROM Users
+        WHERE `+strings.Join(conditions, " AND ")+`
+        ORDER BY `+sortKey+` `+order+`, Users.userId `+order+`
+        LIMIT ?`,
+		append(args, limit+1)...,
 	)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer func() { _ = rows.Close() }()
 
 	users := make([]User, 0)
+	keys := make([]uint, 0)
 	for rows.Next() {
 		var user User
-		if err = rows.Scan(&user.UserId, &user.Username); err != nil {
-			return nil, err
+		var key uint
+		if err = rows.Scan(&user.UserId, &user.Username, &key); err != nil {
+			return nil, "", err
 		}
 		users = append(users, user)
+		keys = append(keys, key)
 	}
-
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return users, nil
+	nextCursor := ""
+	if len(users) > limit {
+		users = users[:limit]
+		nextCursor = encodeCursor(search.Sort, keys[limit-1], users[limit-1].UserId)
+	}
+	return users, nextCursor, nil
 }
 
 /*
@@ -94,33 +145,64 @@ func (db *appdbimpl) GetUserProfile(user User) (User, error) {
 }
 
 /*
-GetMyStream retrieves the content stream of a user from the database given its id.
+streamSortLimit is the number of published photos of the followed users up to which GetMyStream sorts all of them,
+instead of walking the published photos from the newest.
+*/
+const streamSortLimit = 2_000
+
+/*
+GetMyStream retrieves a page of the content stream of a user from the database given its id.
 The stream is composed of the photos uploaded by the users followed by the user.
-The photos are sorted by date, from newest to oldest.
+The photos are sorted by date, from newest to oldest, and their images are left out, see streamColumns.
+
+The plan depends on how many photos the followed users published, counted via their photoCount.
+If they are a few, the photos of each followed user are read via the PhotosOwner index and sorted.
+Otherwise, the published photos are walked from the newest via the PhotosStream index, checking if their owner is
+followed, and stopping as soon as the page is full: since the followed users published many photos, few are skipped.
+CROSS JOIN forces SQLite to use the chosen plan, as its statistics cannot tell how many users a viewer follows.
 */
-func (db *appdbimpl) GetMyStream(user User) ([]Photo, error) {
-	// Get the list of users followed by the user
-	following, err := db.GetFollowingList(user.UserId)
+func (db *appdbimpl) GetMyStream(user User, cursor string, limit int) ([]Photo, string, error) {
+	uploadTime, photoId, err := decodePhotoCursor(cursor)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	// For each user, get the list of photos they have uploaded
-	totalPhotos := make([]Photo, 0)
-	for _, followingUser := range following {
-		photos, err := db.GetPhotoList(followingUser.UserId)
-		if err != nil {
-			return nil, err
-		}
-		totalPhotos = append(totalPhotos, photos...)
+	// Count the photos published by the followed users
+	var followedPhotos int
+	err = db.c.QueryRow(`
+		SELECT COALESCE(SUM(Users.photoCount), 0)
+		FROM Followers
+		INNER JOIN Users ON Followers.followingUserId = Users.userId
+		WHERE Followers.followerUserId = ?`,
+		user.UserId,
+	).Scan(&followedPhotos)
+	if err != nil {
+		return nil, "", err
 	}
 
-	// Sort the photos by date, from newest to oldest
-	sort.Slice(totalPhotos, func(i, j int) bool {
-		return totalPhotos[i].UploadTime > totalPhotos[j].UploadTime
-	})
+	if followedPhotos <= streamSortLimit {
+		return db.queryPhotoPage(
+			`SELECT `+streamColumns+`
+			FROM Followers
+			CROSS JOIN Photos ON Photos.ownerId = Followers.followingUserId
+			INNER JOIN Users ON Photos.ownerId = Users.userId
+			WHERE Followers.followerUserId = ? AND `+photoPublished+` AND `+photoBefore+`
+			ORDER BY Photos.uploadTime DESC, Photos.photoId DESC
+			LIMIT ?`,
+			limit, user.UserId, uploadTime, photoId, limit+1,
+		)
+	}
 
-	return totalPhotos, nil
+	return db.queryPhotoPage(
+		`SELECT `+streamColumns+`
+		FROM Photos
+		CROSS JOIN Users ON Photos.ownerId = Users.userId
+		WHERE `+photoPublished+` AND `+photoBefore+`
+		AND EXISTS (SELECT 1 FROM Followers WHERE followerUserId = ? AND followingUserId = Photos.ownerId)
+		ORDER BY Photos.uploadTime DESC, Photos.photoId DESC
+		LIMIT ?`,
+		limit, uploadTime, photoId, user.UserId, limit+1,
+	)
 }
 
 // SetMyUsername updates the username of a user in the database given its id.
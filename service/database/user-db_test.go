@@ -0,0 +1,254 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Big-Iron-Cheems/WASAPhoto/service/globaltime"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"time"
+)
+
+/*
+The generated datasets: the viewer follows most of the active users, or only a handful of them.
+Every user other than the viewer publishes streamPhotos photos.
+*/
+const (
+	streamUsers     = 3000
+	streamMany      = 2000
+	streamFew       = 5
+	streamPhotos    = 5
+	streamImageSize = 4 << 10
+	streamPageSize  = 50
+)
+
+// streamStart is the time of the first generated photo, the next ones are one minute apart.
+var streamStart = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// newMemoryDatabase creates an empty in-memory database, closed when the test ends.
+func newMemoryDatabase(tb testing.TB) *appdbimpl {
+	conn, err := sql.Open("sqlite3", "file::memory:")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	// Every connection to an in-memory database opens a new one, so a single connection is kept
+	conn.SetMaxOpenConns(1)
+	tb.Cleanup(func() { _ = conn.Close() })
+
+	if _, err = New(conn); err != nil {
+		tb.Fatal(err)
+	}
+	return &appdbimpl{c: conn}
+}
+
+/*
+newStreamDatabase creates an in-memory database with a generated dataset where the viewer follows `following` of the
+streamUsers other users, returning it with the id of the viewer.
+*/
+func newStreamDatabase(b *testing.B, following int) (*appdbimpl, uint) {
+	db := newMemoryDatabase(b)
+	tx, err := db.c.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// The viewer is the first user, followed by the users it follows and then by the others
+	const viewerId = 1
+	users := 1 + streamUsers
+	for userId := 1; userId <= users; userId++ {
+		if _, err = tx.Exec(`INSERT INTO Users (userId, username) VALUES (?, ?)`, userId, fmt.Sprintf("user%d", userId)); err != nil {
+			b.Fatal(err)
+		}
+		if userId > viewerId && userId <= 1+following {
+			if _, err = tx.Exec(`INSERT INTO Followers (followerUserId, followingUserId) VALUES (?, ?)`, viewerId, userId); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	// The photos are uploaded one minute apart, cycling through the users other than the viewer
+	image := make([]byte, streamImageSize)
+	for i := 0; i < (users-1)*streamPhotos; i++ {
+		ownerId := 2 + i%(users-1)
+		uploadTime := streamStart.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)
+		if _, err = tx.Exec(`
+			INSERT INTO Photos (ownerId, image, mimeType, caption, uploadTime, likeCount, commentsCount)
+			VALUES (?, ?, 'image/jpeg', '', ?, 0, 0)`,
+			ownerId, image, uploadTime,
+		); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	if _, err = tx.Exec(`UPDATE Users SET photoCount = (SELECT COUNT(*) FROM Photos WHERE ownerId = Users.userId)`); err != nil {
+		b.Fatal(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+	if _, err = db.c.Exec(`ANALYZE`); err != nil {
+		b.Fatal(err)
+	}
+	return db, viewerId
+}
+
+/*
+BenchmarkGetMyStream measures the first page of the stream, for a viewer following most of the active users and for
+one following only a handful of them.
+*/
+func BenchmarkGetMyStream(b *testing.B) {
+	b.Run("Many", func(b *testing.B) { benchmarkStream(b, streamMany) })
+	b.Run("Few", func(b *testing.B) { benchmarkStream(b, streamFew) })
+}
+
+// benchmarkStream runs BenchmarkGetMyStream on the dataset where the viewer follows `following` users.
+func benchmarkStream(b *testing.B, following int) {
+	db, viewerId := newStreamDatabase(b, following)
+
+	want := following * streamPhotos
+	if want > streamPageSize {
+		want = streamPageSize
+	}
+	stream, _, err := db.GetMyStream(User{UserId: viewerId}, "", streamPageSize)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if len(stream) != want {
+		b.Fatalf("got %d photos, want %d", len(stream), want)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := db.GetMyStream(User{UserId: viewerId}, "", streamPageSize); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// streamUpload is a helper function to upload a photo with the given caption, `minutes` after streamStart.
+func streamUpload(t *testing.T, db *appdbimpl, ownerId uint, caption string, minutes int, publishAt *string) {
+	t.Helper()
+	globaltime.FixedTime = streamStart.Add(time.Duration(minutes) * time.Minute)
+	defer func() { globaltime.FixedTime = time.Time{} }()
+
+	photo := Photo{OwnerId: ownerId, Image: []byte(caption), MimeType: "image/jpeg", Caption: caption, PublishAt: publishAt}
+	if _, err := db.UploadPhoto(photo, Quota{}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// streamFollow is a helper function to make a user follow the given ones.
+func streamFollow(t *testing.T, db *appdbimpl, userId uint, following ...uint) {
+	t.Helper()
+	for _, targetUserId := range following {
+		if err := db.FollowUser(userId, targetUserId); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+/*
+TestGetMyStream checks the order of the stream of alice, read two photos at a time, with both plans of GetMyStream.
+Every case starts with the users alice, bob, carol and dave, and sets up who follows whom and the photos.
+*/
+func TestGetMyStream(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, db *appdbimpl, users map[string]uint)
+		want  []string
+	}{
+		{
+			name: "two followed users",
+			setup: func(t *testing.T, db *appdbimpl, users map[string]uint) {
+				streamFollow(t, db, users["alice"], users["bob"], users["carol"])
+				streamUpload(t, db, users["bob"], "bob 1", 0, nil)
+				streamUpload(t, db, users["carol"], "carol 1", 1, nil)
+				streamUpload(t, db, users["dave"], "dave 1", 2, nil)
+				streamUpload(t, db, users["bob"], "bob 2", 3, nil)
+				// Uploaded in the same second, the newest id comes first
+				streamUpload(t, db, users["carol"], "carol 2", 4, nil)
+				streamUpload(t, db, users["bob"], "bob 3", 4, nil)
+			},
+			want: []string{"bob 3", "carol 2", "bob 2", "carol 1", "bob 1"},
+		},
+		{
+			name: "after a ban",
+			setup: func(t *testing.T, db *appdbimpl, users map[string]uint) {
+				streamFollow(t, db, users["alice"], users["bob"], users["carol"])
+				streamUpload(t, db, users["bob"], "bob 1", 0, nil)
+				streamUpload(t, db, users["carol"], "carol 1", 1, nil)
+				streamUpload(t, db, users["bob"], "bob 2", 2, nil)
+				streamUpload(t, db, users["carol"], "carol 2", 3, nil)
+				if err := db.BanUser(users["carol"], users["alice"]); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"bob 2", "bob 1"},
+		},
+		{
+			name: "scheduled photo",
+			setup: func(t *testing.T, db *appdbimpl, users map[string]uint) {
+				streamFollow(t, db, users["alice"], users["bob"])
+				publishAt := streamStart.Add(24 * time.Hour).Format(time.RFC3339)
+				streamUpload(t, db, users["bob"], "bob 1", 0, nil)
+				streamUpload(t, db, users["bob"], "bob scheduled", 1, &publishAt)
+				streamUpload(t, db, users["bob"], "bob 2", 2, nil)
+				streamUpload(t, db, users["bob"], "bob 3", 3, nil)
+			},
+			want: []string{"bob 3", "bob 2", "bob 1"},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, plan := range []string{"sort", "walk"} {
+			t.Run(tt.name+"/"+plan, func(t *testing.T) {
+				db := newMemoryDatabase(t)
+				users := make(map[string]uint)
+				for _, username := range []string{"alice", "bob", "carol", "dave"} {
+					user, err := db.CreateUser(User{Username: username})
+					if err != nil {
+						t.Fatal(err)
+					}
+					users[username] = user.UserId
+				}
+				tt.setup(t, db, users)
+
+				// GetMyStream walks the photos only when the followed users published many, so pretend they did
+				if plan == "walk" {
+					if _, err := db.c.Exec(`UPDATE Users SET photoCount = photoCount + ?`, streamSortLimit); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				got := make([]string, 0)
+				cursor := ""
+				for page := 0; ; page++ {
+					if page > len(tt.want) {
+						t.Fatalf("the stream did not end after %d pages", page)
+					}
+					photos, next, err := db.GetMyStream(User{UserId: users["alice"]}, cursor, 2)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(photos) > 2 || (next != "" && len(photos) < 2) {
+						t.Fatalf("page %d has %d photos and next cursor %q", page, len(photos), next)
+					}
+					for _, photo := range photos {
+						got = append(got, photo.Caption)
+					}
+					if next == "" {
+						break
+					}
+					cursor = next
+				}
+
+				if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+					t.Errorf("got stream %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
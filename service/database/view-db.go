@@ -0,0 +1,67 @@
+package database
+
+import (
+	"encoding/json"
+	. "github.com/Big-Iron-Cheems/WASAPhoto/service/model"
+)
+
+/*
+RecordPhotoViews Store a batch of views in a single transaction.
+Views already counted for the same viewer, kind and time window are ignored.
+*/
+func (db *appdbimpl) RecordPhotoViews(views []PhotoView) error {
+	if len(views) == 0 {
+		return nil
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.Prepare(`
+        INSERT OR IGNORE INTO PhotoViews (photoId, userId, kind, windowStart)
+        VALUES (?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for _, view := range views {
+		if _, err = stmt.Exec(view.PhotoId, view.UserId, view.Kind, view.WindowStart); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+/*
+GetPhotoStats Get the number of impressions and views of a photo, and how many unique users it reached.
+The pending views, not yet stored, are counted too, unless they were already stored for the same time window.
+*/
+func (db *appdbimpl) GetPhotoStats(photoId uint, pending []PhotoView) (PhotoStats, error) {
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return PhotoStats{}, err
+	}
+
+	stats := PhotoStats{PhotoId: photoId}
+	if err = db.c.QueryRow(`
+        WITH Views(userId, kind, windowStart) AS (
+            SELECT userId, kind, windowStart FROM PhotoViews
+            WHERE photoId = ?
+            UNION
+            SELECT json_extract(value, '$.userId'), json_extract(value, '$.kind'), json_extract(value, '$.windowStart')
+            FROM json_each(?)
+        )
+        SELECT COALESCE(SUM(kind = ?), 0), COALESCE(SUM(kind = ?), 0), COUNT(DISTINCT userId)
+        FROM Views`,
+		photoId, string(data), ViewImpression, ViewOpen,
+	).Scan(&stats.Impressions, &stats.Views, &stats.Reach); err != nil {
+		return PhotoStats{}, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,136 @@
+package geo
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrNoLocation is returned by FromEXIF when the image does not contain a GPS location.
+var ErrNoLocation = errors.New("no GPS location in the image metadata")
+
+// EXIF tags needed to locate and read the GPS coordinates.
+const (
+	tagGPSIFDPointer   = 0x8825
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+)
+
+/*
+FromEXIF extracts the GPS location stored in the EXIF metadata of a JPEG image.
+It returns ErrNoLocation if the image is not a JPEG, has no EXIF metadata, or the metadata has no GPS location.
+*/
+func FromEXIF(image []byte) (Point, error) {
+	tiff := findEXIF(image)
+	if tiff == nil {
+		return Point{}, ErrNoLocation
+	}
+
+	// The TIFF header declares the byte order of the whole block
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return Point{}, ErrNoLocation
+	}
+
+	// Find the GPS IFD through the pointer stored in IFD0
+	ifd0 := readIFD(tiff, order, order.Uint32(tiff[4:8]))
+	gpsEntry, ok := ifd0[tagGPSIFDPointer]
+	if !ok {
+		return Point{}, ErrNoLocation
+	}
+	gps := readIFD(tiff, order, order.Uint32(gpsEntry[8:12]))
+
+	lat, latOk := readDegrees(tiff, order, gps[tagGPSLatitude])
+	lon, lonOk := readDegrees(tiff, order, gps[tagGPSLongitude])
+	if !latOk || !lonOk {
+		return Point{}, ErrNoLocation
+	}
+	if ref, ok := gps[tagGPSLatitudeRef]; ok && ref[8] == 'S' {
+		lat = -lat
+	}
+	if ref, ok := gps[tagGPSLongitudeRef]; ok && ref[8] == 'W' {
+		lon = -lon
+	}
+
+	point := Point{Latitude: lat, Longitude: lon}
+	if !point.Valid() {
+		return Point{}, ErrNoLocation
+	}
+	return point, nil
+}
+
+// findEXIF walks the markers of a JPEG image and returns the TIFF block of its EXIF APP1 segment, if any.
+func findEXIF(image []byte) []byte {
+	if len(image) < 4 || image[0] != 0xFF || image[1] != 0xD8 {
+		return nil
+	}
+
+	for i := 2; i+4 <= len(image); {
+		if image[i] != 0xFF {
+			return nil
+		}
+		marker := image[i+1]
+		// Start of scan: the metadata segments are over
+		if marker == 0xDA {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(image[i+2 : i+4]))
+		if length < 2 || i+2+length > len(image) {
+			return nil
+		}
+		segment := image[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) >= 14 && string(segment[:6]) == "Exif\x00\x00" {
+			return segment[6:]
+		}
+		i += 2 + length
+	}
+	return nil
+}
+
+// readIFD reads the 12 bytes entries of the IFD at the given offset of the TIFF block, keyed by their tag.
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) map[uint16][]byte {
+	entries := make(map[uint16][]byte)
+	if int(offset)+2 > len(tiff) {
+		return entries
+	}
+
+	count := int(order.Uint16(tiff[offset : offset+2]))
+	for i := 0; i < count; i++ {
+		start := int(offset) + 2 + i*12
+		if start+12 > len(tiff) {
+			break
+		}
+		entry := tiff[start : start+12]
+		entries[order.Uint16(entry[:2])] = entry
+	}
+	return entries
+}
+
+// readDegrees reads a GPS coordinate, stored as three rationals (degrees, minutes, seconds), into decimal degrees.
+func readDegrees(tiff []byte, order binary.ByteOrder, entry []byte) (float64, bool) {
+	if entry == nil || order.Uint16(entry[2:4]) != 5 || order.Uint32(entry[4:8]) != 3 {
+		return 0, false
+	}
+
+	offset := int(order.Uint32(entry[8:12]))
+	if offset+24 > len(tiff) {
+		return 0, false
+	}
+
+	var value float64
+	for i, scale := range []float64{1, 60, 3600} {
+		numerator := order.Uint32(tiff[offset+i*8 : offset+i*8+4])
+		denominator := order.Uint32(tiff[offset+i*8+4 : offset+i*8+8])
+		if denominator == 0 {
+			return 0, false
+		}
+		value += float64(numerator) / float64(denominator) / scale
+	}
+	return value, true
+}
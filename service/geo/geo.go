@@ -0,0 +1,176 @@
+/*
+Package geo contains the geographic helpers used to store and search the location of photos.
+
+Locations are indexed via geohashes: a geohash is a string where each character refines the area described by the
+previous ones, so that all the points inside an area share the geohash prefix of that area. This allows searching the
+points inside an area with simple range queries on an indexed text column.
+*/
+package geo
+
+import (
+	"math"
+	"strings"
+)
+
+// Precision is the number of characters of the geohashes stored in the database, roughly 4 cm.
+const Precision = 12
+
+// maxCoverCells is the maximum number of geohash cells returned by Cover.
+const maxCoverCells = 16
+
+// earthRadius is the mean radius of the Earth, in meters.
+const earthRadius = 6371008.8
+
+// base32 is the alphabet used by geohashes.
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Point is a geographic location, in decimal degrees.
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Valid reports whether the point has a latitude in [-90, 90] and a longitude in [-180, 180].
+func (p Point) Valid() bool {
+	return p.Latitude >= -90 && p.Latitude <= 90 && p.Longitude >= -180 && p.Longitude <= 180
+}
+
+// Box is a geographic area delimited by two parallels and two meridians, in decimal degrees.
+type Box struct {
+	MinLatitude  float64
+	MinLongitude float64
+	MaxLatitude  float64
+	MaxLongitude float64
+}
+
+// Valid reports whether the corners of the box are valid points, and the minimums are not greater than the maximums.
+func (b Box) Valid() bool {
+	return Point{b.MinLatitude, b.MinLongitude}.Valid() && Point{b.MaxLatitude, b.MaxLongitude}.Valid() &&
+		b.MinLatitude <= b.MaxLatitude && b.MinLongitude <= b.MaxLongitude
+}
+
+// Contains reports whether the point lies inside the box, borders included.
+func (b Box) Contains(p Point) bool {
+	return p.Latitude >= b.MinLatitude && p.Latitude <= b.MaxLatitude &&
+		p.Longitude >= b.MinLongitude && p.Longitude <= b.MaxLongitude
+}
+
+// Encode returns the geohash of the point with the given number of characters.
+func Encode(p Point, precision int) string {
+	minLat, maxLat := -90.0, 90.0
+	minLon, maxLon := -180.0, 180.0
+
+	var hash strings.Builder
+	evenBit := true
+	bit, ch := 0, 0
+	for hash.Len() < precision {
+		// Even bits refine the longitude, odd bits refine the latitude
+		if evenBit {
+			mid := (minLon + maxLon) / 2
+			if p.Longitude >= mid {
+				ch = ch<<1 | 1
+				minLon = mid
+			} else {
+				ch <<= 1
+				maxLon = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if p.Latitude >= mid {
+				ch = ch<<1 | 1
+				minLat = mid
+			} else {
+				ch <<= 1
+				maxLat = mid
+			}
+		}
+		evenBit = !evenBit
+
+		// Every 5 bits, emit a character
+		bit++
+		if bit == 5 {
+			hash.WriteByte(base32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return hash.String()
+}
+
+// cellSize returns the width and height, in degrees, of the geohash cells with the given number of characters.
+func cellSize(precision int) (float64, float64) {
+	bits := 5 * precision
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 360 / math.Pow(2, float64(lonBits)), 180 / math.Pow(2, float64(latBits))
+}
+
+/*
+Cover returns a list of geohash prefixes whose cells together cover the box.
+
+The longest prefixes keeping the list within a small number of cells are chosen, so the cells may extend beyond the
+box: the points found through them should still be checked with Box.Contains.
+*/
+func Cover(b Box) []string {
+	precision := 1
+	for p := Precision; p > 1; p-- {
+		width, height := cellSize(p)
+		columns := math.Floor((b.MaxLongitude+180)/width) - math.Floor((b.MinLongitude+180)/width) + 1
+		rows := math.Floor((b.MaxLatitude+90)/height) - math.Floor((b.MinLatitude+90)/height) + 1
+		if columns*rows <= maxCoverCells {
+			precision = p
+			break
+		}
+	}
+
+	// Walk the cells overlapping the box, encoding the center of each of them
+	width, height := cellSize(precision)
+	prefixes := make([]string, 0)
+	seen := make(map[string]bool)
+	for lat := math.Floor((b.MinLatitude+90)/height)*height - 90; lat <= b.MaxLatitude; lat += height {
+		for lon := math.Floor((b.MinLongitude+180)/width)*width - 180; lon <= b.MaxLongitude; lon += width {
+			center := Point{Latitude: math.Min(lat+height/2, 90), Longitude: math.Min(lon+width/2, 180)}
+			prefix := Encode(center, precision)
+			if !seen[prefix] {
+				seen[prefix] = true
+				prefixes = append(prefixes, prefix)
+			}
+		}
+	}
+	return prefixes
+}
+
+// Distance returns the great-circle distance between two points, in meters.
+func Distance(a Point, b Point) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+/*
+BoxAround returns the smallest box containing all the points within `radius` meters from the center.
+The box is clamped to the valid coordinates: near the poles or the antimeridian, it spans all the longitudes.
+*/
+func BoxAround(center Point, radius float64) Box {
+	dLat := radius / earthRadius * 180 / math.Pi
+	box := Box{
+		MinLatitude:  math.Max(center.Latitude-dLat, -90),
+		MaxLatitude:  math.Min(center.Latitude+dLat, 90),
+		MinLongitude: -180,
+		MaxLongitude: 180,
+	}
+
+	// The span of the longitudes grows with the latitude
+	cosLat := math.Cos(math.Max(math.Abs(box.MinLatitude), math.Abs(box.MaxLatitude)) * math.Pi / 180)
+	if cosLat > 0 {
+		dLon := dLat / cosLat
+		if center.Longitude-dLon >= -180 && center.Longitude+dLon <= 180 {
+			box.MinLongitude = center.Longitude - dLon
+			box.MaxLongitude = center.Longitude + dLon
+		}
+	}
+	return box
+}
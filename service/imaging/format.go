@@ -0,0 +1,227 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+// MIME types of the supported image formats.
+const (
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+	GIF  = "image/gif"
+	WebP = "image/webp"
+	AVIF = "image/avif"
+	HEIC = "image/heic"
+	HEIF = "image/heif"
+)
+
+// ErrUnknownFormat is returned when the format of an image is not one of the supported ones.
+var ErrUnknownFormat = errors.New("unknown image format, supported formats are JPEG, PNG, GIF, WebP, AVIF and HEIC")
+
+// ErrAnimated is returned when trying to edit an animated image, which would lose its animation.
+var ErrAnimated = errors.New("animated images cannot be edited")
+
+/*
+DetectFormat returns the MIME type of an image, detected from its magic bytes.
+AVIF and HEIC images are recognized from the brands of their ISO base media file format `ftyp` box.
+*/
+func DetectFormat(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return JPEG, nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return PNG, nil
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return GIF, nil
+	case len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return WebP, nil
+	}
+
+	// The ftyp box holds a major brand, a minor version and a list of compatible brands, 4 bytes each
+	if len(data) < 16 || !bytes.Equal(data[4:8], []byte("ftyp")) {
+		return "", ErrUnknownFormat
+	}
+	size := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	if size < 16 || size > len(data) {
+		return "", ErrUnknownFormat
+	}
+	brands := [][]byte{data[8:12]}
+	for i := 16; i+4 <= size; i += 4 {
+		brands = append(brands, data[i:i+4])
+	}
+
+	mimeType := ""
+	for _, brand := range brands {
+		switch string(brand) {
+		case "avif", "avis":
+			return AVIF, nil
+		case "heic", "heix", "hevc", "hevx", "heim", "heis":
+			mimeType = HEIC
+		case "mif1", "msf1":
+			if mimeType == "" {
+				mimeType = HEIF
+			}
+		}
+	}
+	if mimeType == "" {
+		return "", ErrUnknownFormat
+	}
+	return mimeType, nil
+}
+
+// CanDecode checks if images of the given MIME type can be decoded, and so edited or transcoded.
+func CanDecode(mimeType string) bool {
+	return mimeType == JPEG || mimeType == PNG || mimeType == GIF
+}
+
+// CanEncode checks if images can be encoded to the given MIME type, and so transcoded to it.
+func CanEncode(mimeType string) bool {
+	return mimeType == JPEG || mimeType == PNG
+}
+
+/*
+IsAnimated checks if an image has more than one frame.
+Only GIF and WebP images can be animated, WebP ones are recognized from their `ANIM` chunk.
+No pixel is decoded, so that the check is cheap even for images declaring a huge size.
+*/
+func IsAnimated(data []byte) bool {
+	mimeType, err := DetectFormat(data)
+	if err != nil {
+		return false
+	}
+
+	switch mimeType {
+	case GIF:
+		return gifFrames(data) > 1
+	case WebP:
+		// Animated images use the extended format, whose VP8X chunk has the animation flag
+		return len(data) >= 21 && bytes.Equal(data[12:16], []byte("VP8X")) && data[20]&0x02 != 0
+	}
+	return false
+}
+
+/*
+gifFrames counts the frames of a GIF image, walking its blocks up to the second image descriptor.
+The header is followed by the logical screen descriptor and the optional global color table, then by a sequence of
+extensions (0x21) and images (0x2C), each one made of data sub-blocks, until the trailer (0x3B).
+A truncated or malformed image counts the frames found until then.
+*/
+func gifFrames(data []byte) int {
+	// The flags of the logical screen descriptor tell the size of the global color table
+	if len(data) < 13 {
+		return 0
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&0x07 + 1)
+	}
+
+	// skipSubBlocks returns the position after the sub-blocks starting at i, or -1 if they are truncated
+	skipSubBlocks := func(i int) int {
+		for i < len(data) {
+			size := int(data[i])
+			if size == 0 {
+				return i + 1
+			}
+			i += 1 + size
+		}
+		return -1
+	}
+
+	frames := 0
+	for pos >= 0 && pos < len(data) && frames < 2 {
+		switch data[pos] {
+		case 0x21:
+			// Extension introducer and label, followed by its sub-blocks
+			pos = skipSubBlocks(pos + 2)
+		case 0x2C:
+			// Image descriptor, with the optional local color table, the LZW code size and the image sub-blocks
+			frames++
+			if pos+10 > len(data) {
+				return frames
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos = skipSubBlocks(pos + 1)
+		default:
+			// Trailer, or an invalid block
+			return frames
+		}
+	}
+	return frames
+}
+
+/*
+Transcode converts an image to the given MIME type, which must be one that CanEncode.
+Animated images keep only their first frame, and transparent areas become white when converting to JPEG.
+*/
+func Transcode(data []byte, mimeType string) ([]byte, error) {
+	if !CanEncode(mimeType) {
+		return nil, ErrUnsupportedFormat
+	}
+	source, err := DetectFormat(data)
+	if err != nil {
+		return nil, err
+	}
+	if source == mimeType {
+		return data, nil
+	}
+	if !CanDecode(source) {
+		return nil, ErrUnsupportedFormat
+	}
+
+	img, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return encode(img, mimeType)
+}
+
+// decode decodes an image, checking its size first to bound the memory used.
+func decode(data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, errors.New("image is too large to be processed")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	return img, nil
+}
+
+// encode encodes an image to the given MIME type, which must be one that CanEncode.
+func encode(img image.Image, mimeType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch mimeType {
+	case JPEG:
+		// JPEG has no transparency, so the image is placed on a white background
+		bounds := img.Bounds()
+		opaque := image.NewRGBA(bounds)
+		draw.Draw(opaque, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(opaque, bounds, img, bounds.Min, draw.Over)
+		err = jpeg.Encode(&buf, opaque, &jpeg.Options{Quality: jpegQuality})
+	case PNG:
+		err = png.Encode(&buf, img)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,188 @@
+/*
+Package imaging contains the pure Go image processing used to edit photos on the server.
+
+An edit is a declarative list of Operation values, applied in order to the decoded image. The edited image is encoded
+back in its original format, except for GIF images which are encoded as PNG to avoid a lossy palette conversion.
+
+Images are recognized from their magic bytes. JPEG, PNG and GIF images can be decoded, edited and transcoded, while
+WebP, AVIF and HEIC images are recognized but can only be stored as they are, as there are no pure Go decoders for
+them in the standard library.
+*/
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"  // Register the GIF decoder
+	_ "image/jpeg" // Register the JPEG decoder
+	_ "image/png"  // Register the PNG decoder
+)
+
+// MaxOperations is the maximum number of operations in a single edit.
+const MaxOperations = 16
+
+// MaxSize is the maximum width and height of an edited image, in pixels.
+const MaxSize = 4096
+
+// maxPixels is the maximum number of pixels of an image to be decoded, bounding its RGBA decoding to 160 MB.
+const maxPixels = 40_000_000
+
+// jpegQuality is the quality used when encoding edited JPEG images.
+const jpegQuality = 90
+
+// Operation types.
+const (
+	Crop      = "crop"
+	Rotate    = "rotate"
+	Flip      = "flip"
+	Resize    = "resize"
+	Grayscale = "grayscale"
+	Sepia     = "sepia"
+	Contrast  = "contrast"
+)
+
+// ErrUnsupportedFormat is returned when the image cannot be decoded, or encoded to the requested format.
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+/*
+Operation is a single step of an edit. Only the fields relevant to its Type are used:
+  - crop keeps the rectangle at X, Y of size Width x Height.
+  - rotate turns the image clockwise by Angle degrees, one of 90, 180 and 270.
+  - flip mirrors the image, Direction is either "horizontal" or "vertical".
+  - resize scales the image to Width x Height, if one of them is 0 it is computed keeping the aspect ratio.
+  - grayscale and sepia have no parameters.
+  - contrast changes the contrast by Amount, from -100 (flat gray) to 100.
+*/
+type Operation struct {
+	Type      string  `json:"type"`
+	X         int     `json:"x,omitempty"`
+	Y         int     `json:"y,omitempty"`
+	Width     int     `json:"width,omitempty"`
+	Height    int     `json:"height,omitempty"`
+	Angle     int     `json:"angle,omitempty"`
+	Direction string  `json:"direction,omitempty"`
+	Amount    float64 `json:"amount,omitempty"`
+}
+
+// Validate checks the parameters of the operation that do not depend on the image.
+func (op Operation) Validate() error {
+	switch op.Type {
+	case Crop:
+		if op.X < 0 || op.Y < 0 || op.Width <= 0 || op.Height <= 0 {
+			return errors.New("crop needs a non-negative position and a positive size")
+		}
+	case Rotate:
+		if op.Angle != 90 && op.Angle != 180 && op.Angle != 270 {
+			return errors.New("rotate angle must be 90, 180 or 270")
+		}
+	case Flip:
+		if op.Direction != "horizontal" && op.Direction != "vertical" {
+			return errors.New("flip direction must be horizontal or vertical")
+		}
+	case Resize:
+		if op.Width < 0 || op.Height < 0 || (op.Width == 0 && op.Height == 0) {
+			return errors.New("resize needs a positive width or height")
+		}
+		if op.Width > MaxSize || op.Height > MaxSize {
+			return fmt.Errorf("resize cannot exceed %d pixels", MaxSize)
+		}
+	case Grayscale, Sepia:
+	case Contrast:
+		if op.Amount < -100 || op.Amount > 100 {
+			return errors.New("contrast amount must be between -100 and 100")
+		}
+	default:
+		return fmt.Errorf("unknown operation `%s`", op.Type)
+	}
+	return nil
+}
+
+// Validate checks all the operations of an edit.
+func Validate(ops []Operation) error {
+	if len(ops) > MaxOperations {
+		return fmt.Errorf("an edit can have at most %d operations", MaxOperations)
+	}
+	for i, op := range ops {
+		if err := op.Validate(); err != nil {
+			return fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Apply runs the operations on the image, in order.
+func Apply(img image.Image, ops []Operation) (image.Image, error) {
+	if err := Validate(ops); err != nil {
+		return nil, err
+	}
+
+	// Work on a copy with origin (0, 0), so that the operations never modify the input
+	bounds := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(out, out.Bounds(), img, bounds.Min, draw.Src)
+
+	for i, op := range ops {
+		var err error
+		switch op.Type {
+		case Crop:
+			out, err = crop(out, image.Rect(op.X, op.Y, op.X+op.Width, op.Y+op.Height))
+		case Rotate:
+			out = rotate(out, op.Angle)
+		case Flip:
+			out = flip(out, op.Direction == "horizontal")
+		case Resize:
+			out, err = resize(out, op.Width, op.Height)
+		case Grayscale:
+			grayscale(out)
+		case Sepia:
+			sepia(out)
+		case Contrast:
+			contrast(out, op.Amount)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	return out, nil
+}
+
+/*
+Edit decodes an encoded image, applies the operations and encodes the result.
+It returns the encoded image along with its MIME type.
+Only the formats that CanDecode can be edited, and animated images cannot be edited as they would lose their animation.
+*/
+func Edit(data []byte, ops []Operation) ([]byte, string, error) {
+	mimeType, err := DetectFormat(data)
+	if err != nil {
+		return nil, "", err
+	}
+	if !CanDecode(mimeType) {
+		return nil, "", ErrUnsupportedFormat
+	}
+	if IsAnimated(data) {
+		return nil, "", ErrAnimated
+	}
+
+	img, err := decode(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	edited, err := Apply(img, ops)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if mimeType != JPEG {
+		mimeType = PNG
+	}
+	encoded, err := encode(edited, mimeType)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return encoded, mimeType, nil
+}
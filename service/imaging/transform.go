@@ -0,0 +1,167 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+)
+
+// crop returns the part of the image inside the rectangle, clipped to the image bounds.
+func crop(img *image.NRGBA, rect image.Rectangle) (*image.NRGBA, error) {
+	rect = rect.Intersect(img.Bounds())
+	if rect.Empty() {
+		return nil, errors.New("crop rectangle is outside the image")
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	for y := 0; y < rect.Dy(); y++ {
+		src := img.PixOffset(rect.Min.X, rect.Min.Y+y)
+		copy(out.Pix[y*out.Stride:y*out.Stride+rect.Dx()*4], img.Pix[src:src+rect.Dx()*4])
+	}
+	return out, nil
+}
+
+// rotate turns the image clockwise by 90, 180 or 270 degrees.
+func rotate(img *image.NRGBA, angle int) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	var out *image.NRGBA
+	if angle == 180 {
+		out = image.NewNRGBA(image.Rect(0, 0, w, h))
+	} else {
+		out = image.NewNRGBA(image.Rect(0, 0, h, w))
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch angle {
+			case 90:
+				dx, dy = h-1-y, x
+			case 180:
+				dx, dy = w-1-x, h-1-y
+			case 270:
+				dx, dy = y, w-1-x
+			}
+			copy(out.Pix[out.PixOffset(dx, dy):out.PixOffset(dx, dy)+4], img.Pix[img.PixOffset(x, y):img.PixOffset(x, y)+4])
+		}
+	}
+	return out
+}
+
+// flip mirrors the image horizontally (left to right) or vertically (top to bottom).
+func flip(img *image.NRGBA, horizontal bool) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := x, h-1-y
+			if horizontal {
+				dx, dy = w-1-x, y
+			}
+			copy(out.Pix[out.PixOffset(dx, dy):out.PixOffset(dx, dy)+4], img.Pix[img.PixOffset(x, y):img.PixOffset(x, y)+4])
+		}
+	}
+	return out
+}
+
+/*
+resize scales the image to the given size, computing a missing (0) dimension from the aspect ratio.
+Each destination pixel is the average of the source pixels it covers, which reduces to nearest-neighbor when enlarging.
+*/
+func resize(img *image.NRGBA, width int, height int) (*image.NRGBA, error) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if width == 0 {
+		width = int(math.Round(float64(w) * float64(height) / float64(h)))
+	}
+	if height == 0 {
+		height = int(math.Round(float64(h) * float64(width) / float64(w)))
+	}
+	if width < 1 || height < 1 || width > MaxSize || height > MaxSize {
+		return nil, fmt.Errorf("resized image must be between 1 and %d pixels wide and high", MaxSize)
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for dy := 0; dy < height; dy++ {
+		y0 := dy * h / height
+		y1 := (dy + 1) * h / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for dx := 0; dx < width; dx++ {
+			x0 := dx * w / width
+			x1 := (dx + 1) * w / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			// Average the covered pixels, weighting the color by the alpha to avoid dark fringes
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					p := img.Pix[img.PixOffset(x, y):]
+					pa := uint64(p[3])
+					r += uint64(p[0]) * pa
+					g += uint64(p[1]) * pa
+					b += uint64(p[2]) * pa
+					a += pa
+					n++
+				}
+			}
+
+			d := out.Pix[out.PixOffset(dx, dy):]
+			if a > 0 {
+				d[0] = uint8(r / a)
+				d[1] = uint8(g / a)
+				d[2] = uint8(b / a)
+			}
+			d[3] = uint8(a / n)
+		}
+	}
+	return out, nil
+}
+
+// grayscale replaces the color of each pixel with its luma, in place.
+func grayscale(img *image.NRGBA) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		p := img.Pix[i : i+3]
+		l := clamp(0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2]))
+		p[0], p[1], p[2] = l, l, l
+	}
+}
+
+// sepia applies the classic sepia tone matrix to each pixel, in place.
+func sepia(img *image.NRGBA) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		p := img.Pix[i : i+3]
+		r, g, b := float64(p[0]), float64(p[1]), float64(p[2])
+		p[0] = clamp(0.393*r + 0.769*g + 0.189*b)
+		p[1] = clamp(0.349*r + 0.686*g + 0.168*b)
+		p[2] = clamp(0.272*r + 0.534*g + 0.131*b)
+	}
+}
+
+// contrast scales the distance of each channel from the middle gray by a factor derived from amount, in place.
+func contrast(img *image.NRGBA, amount float64) {
+	factor := (100 + amount) / 100
+	factor *= factor
+	for i := 0; i < len(img.Pix); i += 4 {
+		p := img.Pix[i : i+3]
+		for c := range p {
+			p[c] = clamp((float64(p[c])-127.5)*factor + 127.5)
+		}
+	}
+}
+
+// clamp rounds a channel value to the nearest valid uint8.
+func clamp(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
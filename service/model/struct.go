@@ -30,14 +30,73 @@ Since this data is public, it is not modifiable.
   - FollowersCount is the number of followers of the user.
   - FollowingCount is the number of users followed by the user.
   - BannedCount is the number of users banned by the user.
+  - Usage is the storage usage of the user, only shown to the user themselves.
+  - Relationship is the relationship between the requester and the user, only shown to the other users.
 */
 type Profile struct {
-	UserId         uint   `json:"userId"`
-	Username       string `json:"username"`
-	PhotoCount     uint   `json:"photoCount"`
-	FollowersCount uint   `json:"followersCount"`
-	FollowingCount uint   `json:"followingCount"`
-	BannedCount    uint   `json:"bannedCount"`
+	UserId         uint          `json:"userId"`
+	Username       string        `json:"username"`
+	PhotoCount     uint          `json:"photoCount"`
+	FollowersCount uint          `json:"followersCount"`
+	FollowingCount uint          `json:"followingCount"`
+	BannedCount    uint          `json:"bannedCount"`
+	Usage          *StorageUsage `json:"usage,omitempty"`
+	Relationship   *Relationship `json:"relationship,omitempty"`
+}
+
+/*
+Relationship struct modeling the schema of the relationship between the requester and another user.
+  - Following is whether the requester follows the user.
+  - FollowedBy is whether the user follows the requester.
+  - Banned is whether the requester banned the user.
+  - BannedBy is whether the user banned the requester.
+  - MutualFollowers is a sample of the users followed by the requester who follow the user.
+  - MutualFollowersCount is the total number of users followed by the requester who follow the user.
+*/
+type Relationship struct {
+	Following            bool   `json:"following"`
+	FollowedBy           bool   `json:"followedBy"`
+	Banned               bool   `json:"banned"`
+	BannedBy             bool   `json:"bannedBy"`
+	MutualFollowers      []User `json:"mutualFollowers"`
+	MutualFollowersCount uint   `json:"mutualFollowersCount"`
+}
+
+/*
+UserSearch struct modeling the filters and the order of a list of users.
+  - Query is the text the usernames must start with, ignoring case, empty for every user.
+  - Substring is whether the usernames can contain the Query anywhere, instead of only at their start.
+  - Sort is the order of the users, one of the UserSort constants.
+  - FollowedBy is the User.UserId of the user who must follow the listed users, 0 for every user.
+*/
+type UserSearch struct {
+	Query      string
+	Substring  bool
+	Sort       string
+	FollowedBy uint
+}
+
+// Orders of a UserSearch.
+const (
+	UserSortJoined    = "joined"    // By join date, oldest first
+	UserSortFollowers = "followers" // By number of followers, most followed first
+	UserSortPhotos    = "photos"    // By number of published photos, most first
+)
+
+/*
+Suggestion struct modeling the schema of a user suggested to follow.
+  - UserId is used to identify the suggested user.
+  - Username is used to display the suggested user.
+  - MutualFollowers is the number of users followed by the requester who follow the suggested user.
+  - SharedLikes is the number of photos liked by both the requester and the suggested user.
+  - LastPostedAt is the time when the suggested user last posted a photo, empty if they never did.
+*/
+type Suggestion struct {
+	UserId          uint   `json:"userId"`
+	Username        string `json:"username"`
+	MutualFollowers uint   `json:"mutualFollowers"`
+	SharedLikes     uint   `json:"sharedLikes"`
+	LastPostedAt    string `json:"lastPostedAt"`
 }
 
 /*
@@ -45,23 +104,49 @@ Photo struct modeling the schema of a photo.
   - PhotoId is not modifiable, and it is used to identify the photo.
   - OwnerId is not modifiable, and it is used to identify the owner of the photo. It is a User.UserId.
   - OwnerUsername is the User.Username of the owner of the photo.
-  - Image is the binary content of the photo.
+  - Image is the binary content of the photo, it is left out of the stream.
   - MimeType is the MIME type of the photo.
   - Caption is the text caption of the photo.
+  - AltText is the optional description of the image for the users of screen readers.
   - UploadTime is the time when the photo was uploaded.
-  - LikeCount is the number of likes of the photo.
+  - LikeCount is the number of likes of the photo, counting every reaction.
+  - Reactions is the number of reactions to the photo, by reaction.
   - CommentsCount is the number of comments of the photo.
+  - Latitude is the optional latitude where the photo was taken, in decimal degrees.
+  - Longitude is the optional longitude where the photo was taken, in decimal degrees.
+  - PlaceName is the optional name of the place where the photo was taken.
+  - Archived is whether the photo was hidden by its owner, without deleting it.
+  - PublishAt is the time when a scheduled photo will be published, it is only set until then.
+  - Sensitive is whether the photo was marked as sensitive media, by its owner or by a moderator.
+  - SensitiveReason is the optional content warning of a sensitive photo.
+  - SensitiveBy is the User.UserId of who marked the photo as sensitive.
+  - Blurred is whether the viewer asked for sensitive photos like this one to be blurred.
+  - CommentsLocked is whether the owner turned off new comments on the photo.
+  - Animated is whether the image has more than one frame, checked once when it is stored.
 */
 type Photo struct {
-	PhotoId       uint   `json:"photoId"`
-	OwnerId       uint   `json:"ownerId"`
-	OwnerUsername string `json:"ownerUsername"` // Calculated via JOIN, not stored in the database
-	Image         []byte `json:"image"`
-	MimeType      string `json:"mimeType"`
-	Caption       string `json:"caption"`
-	UploadTime    string `json:"uploadTime"`
-	LikeCount     uint   `json:"likeCount"`
-	CommentsCount uint   `json:"commentsCount"`
+	PhotoId         uint            `json:"photoId"`
+	OwnerId         uint            `json:"ownerId"`
+	OwnerUsername   string          `json:"ownerUsername"` // Calculated via JOIN, not stored in the database
+	Image           []byte          `json:"image,omitempty"`
+	MimeType        string          `json:"mimeType"`
+	Caption         string          `json:"caption"`
+	AltText         string          `json:"altText"`
+	UploadTime      string          `json:"uploadTime"`
+	LikeCount       uint            `json:"likeCount"`
+	Reactions       map[string]uint `json:"reactions"` // Calculated via JOIN, not stored in the database
+	CommentsCount   uint            `json:"commentsCount"`
+	Latitude        *float64        `json:"latitude,omitempty"`
+	Longitude       *float64        `json:"longitude,omitempty"`
+	PlaceName       string          `json:"placeName,omitempty"`
+	Archived        bool            `json:"archived"`
+	PublishAt       *string         `json:"publishAt,omitempty"`
+	Sensitive       bool            `json:"sensitive"`
+	SensitiveReason string          `json:"sensitiveReason,omitempty"`
+	SensitiveBy     *uint           `json:"-"`
+	Blurred         bool            `json:"blurred,omitempty"` // Calculated for each viewer, not stored in the database
+	CommentsLocked  bool            `json:"commentsLocked"`
+	Animated        bool            `json:"animated"`
 }
 
 /*
@@ -69,13 +154,231 @@ Comment struct modeling the schema of a comment.
   - CommentId is not modifiable, and it is used to identify the comment.
   - OwnerId is not modifiable, and it is used to identify the owner of the comment. It is a User.UserId.
   - OwnerUsername is the User.Username of the owner of the comment.
+  - PhotoId is the Photo.PhotoId of the photo the comment is under.
   - Content is the content of the comment.
+  - CreatedAt is the time when the comment was posted, empty for the comments posted before it was recorded.
+  - EditedAt is the time of the last edit of the comment, it is only set if the comment was edited.
+  - PinnedAt is the time when the owner of the photo pinned the comment to the top, it is only set while pinned.
+  - ParentCommentId is the CommentId of the comment this one replies to, if any.
+  - Deleted is whether the comment was deleted while having replies, its owner and content are then hidden.
+  - Approved is whether the owner of the photo approved the comment, so that their hidden words do not apply to it.
+  - Hidden is whether the comment contains a hidden word of the owner of the photo, so that only its author sees it.
+  - ReplyCount is the number of direct replies to the comment.
+  - Reactions is the number of reactions to the comment, by reaction.
+  - MyReaction is the reaction of the viewer to the comment, if any.
+  - Replies are the direct replies to the comment, only filled up to the requested depth.
 */
 type Comment struct {
-	CommentId     uint   `json:"commentId"`
+	CommentId       uint            `json:"commentId"`
+	OwnerId         uint            `json:"ownerId"`
+	OwnerUsername   string          `json:"ownerUsername"` // Calculated via JOIN, not stored in the database
+	PhotoId         uint            `json:"photoId"`
+	Content         string          `json:"content"`
+	CreatedAt       string          `json:"createdAt"`
+	EditedAt        *string         `json:"editedAt,omitempty"`
+	PinnedAt        *string         `json:"pinnedAt,omitempty"`
+	ParentCommentId *uint           `json:"parentCommentId,omitempty"`
+	Deleted         bool            `json:"deleted,omitempty"`
+	Approved        bool            `json:"-"`
+	Hidden          bool            `json:"hidden,omitempty"`     // Calculated from the hidden words, not stored in the database
+	ReplyCount      uint            `json:"replyCount"`           // Calculated from the replies, not stored in the database
+	Reactions       map[string]uint `json:"reactions"`            // Calculated via JOIN, not stored in the database
+	MyReaction      string          `json:"myReaction,omitempty"` // Calculated for each viewer, not stored in the database
+	Replies         []Comment       `json:"replies,omitempty"`    // Calculated from the replies, not stored in the database
+}
+
+/*
+CommentVersion struct modeling a previous version of an edited comment.
+  - Content is the content of the comment before the edit.
+  - WrittenAt is the time when this version was written, by posting or editing the comment.
+  - ReplacedAt is the time when this version was replaced by an edit.
+*/
+type CommentVersion struct {
+	Content    string `json:"content"`
+	WrittenAt  string `json:"writtenAt"`
+	ReplacedAt string `json:"replacedAt"`
+}
+
+/*
+Tag struct modeling the schema of a user tagged in a photo.
+  - PhotoId is the Photo.PhotoId of the photo the tag belongs to.
+  - UserId is the User.UserId of the tagged user.
+  - Username is the User.Username of the tagged user.
+  - X is the horizontal position of the tag on the image, normalized between 0 (left edge) and 1 (right edge).
+  - Y is the vertical position of the tag on the image, normalized between 0 (top edge) and 1 (bottom edge).
+*/
+type Tag struct {
+	PhotoId  uint    `json:"photoId"`
+	UserId   uint    `json:"userId"`
+	Username string  `json:"username"` // Calculated via JOIN, not stored in the database
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+}
+
+// Kinds of PhotoView.
+const (
+	ViewImpression = "impression" // The photo was returned in the stream of the viewer
+	ViewOpen       = "open"       // The viewer opened the image of the photo
+)
+
+/*
+PhotoView struct modeling a view of a photo, counted once per viewer, kind and time window.
+  - PhotoId is the Photo.PhotoId of the viewed photo.
+  - UserId is the User.UserId of the viewer.
+  - Kind is either ViewImpression or ViewOpen.
+  - WindowStart is the start of the time window the view was counted in.
+*/
+type PhotoView struct {
+	PhotoId     uint   `json:"photoId"`
+	UserId      uint   `json:"userId"`
+	Kind        string `json:"kind"`
+	WindowStart string `json:"windowStart"`
+}
+
+/*
+PhotoStats struct modeling the analytics of a photo, shown to its owner.
+  - PhotoId is the Photo.PhotoId of the photo.
+  - Impressions is the number of times the photo was returned in the stream of a viewer, once per time window.
+  - Views is the number of times the photo was opened by a viewer, once per time window.
+  - Reach is the number of unique users who were shown or opened the photo.
+*/
+type PhotoStats struct {
+	PhotoId     uint `json:"photoId"`
+	Impressions uint `json:"impressions"`
+	Views       uint `json:"views"`
+	Reach       uint `json:"reach"`
+}
+
+/*
+Story struct modeling the schema of a story, a short-lived photo separate from the permanent ones.
+  - StoryId is not modifiable, and it is used to identify the story.
+  - OwnerId is not modifiable, and it is used to identify the owner of the story. It is a User.UserId.
+  - OwnerUsername is the User.Username of the owner of the story.
+  - Image is the binary content of the story, it is left out of the lists of stories.
+  - MimeType is the MIME type of the story.
+  - Caption is the text caption of the story.
+  - CreatedAt is the time when the story was posted.
+  - ExpiresAt is the time when the story will be deleted.
+  - Seen is whether the viewer has already seen the story.
+*/
+type Story struct {
+	StoryId       uint   `json:"storyId"`
 	OwnerId       uint   `json:"ownerId"`
 	OwnerUsername string `json:"ownerUsername"` // Calculated via JOIN, not stored in the database
-	Content       string `json:"content"`
+	Image         []byte `json:"image,omitempty"`
+	MimeType      string `json:"mimeType"`
+	Caption       string `json:"caption"`
+	CreatedAt     string `json:"createdAt"`
+	ExpiresAt     string `json:"expiresAt"`
+	Seen          bool   `json:"seen"` // Calculated for each viewer, not stored in the database
+}
+
+/*
+StoryGroup struct modeling the active stories of a user, as shown to their followers.
+  - UserId is the User.UserId of the owner of the stories.
+  - Username is the User.Username of the owner of the stories.
+  - Stories are the active stories of the user, from oldest to newest.
+*/
+type StoryGroup struct {
+	UserId   uint    `json:"userId"`
+	Username string  `json:"username"`
+	Stories  []Story `json:"stories"`
+}
+
+/*
+StoryView struct modeling a user who has seen a story.
+  - UserId is the User.UserId of the viewer.
+  - Username is the User.Username of the viewer.
+  - SeenAt is the time when the viewer first saw the story.
+*/
+type StoryView struct {
+	UserId   uint   `json:"userId"`
+	Username string `json:"username"` // Calculated via JOIN, not stored in the database
+	SeenAt   string `json:"seenAt"`
+}
+
+/*
+Settings struct modeling the preferences of a user.
+  - SensitiveMedia is how the photos marked as sensitive are shown to the user: "show", "blur" or "hide".
+*/
+type Settings struct {
+	SensitiveMedia string `json:"sensitiveMedia"`
+}
+
+/*
+Collection struct modeling the schema of a private collection of saved photos.
+  - CollectionId is not modifiable, and it is used to identify the collection.
+  - OwnerId is not modifiable, and it is used to identify the owner of the collection. It is a User.UserId.
+  - Name is the name of the collection, unique among the collections of the owner.
+  - CreatedAt is the time when the collection was created.
+  - PhotoCount is the number of photos saved in the collection and still visible to the owner.
+*/
+type Collection struct {
+	CollectionId uint   `json:"collectionId"`
+	OwnerId      uint   `json:"ownerId"`
+	Name         string `json:"name"`
+	CreatedAt    string `json:"createdAt"`
+	PhotoCount   uint   `json:"photoCount"` // Calculated via JOIN, not stored in the database
+}
+
+/*
+Upload struct modeling the schema of a resumable upload of a photo.
+  - UploadId is not modifiable, and it is used to identify the upload.
+  - OwnerId is not modifiable, and it is used to identify the owner of the upload. It is a User.UserId.
+  - Length is the total size of the image being uploaded, in bytes.
+  - Offset is the number of bytes received so far.
+  - Metadata is the raw tus metadata of the upload, holding the other fields of the photo.
+  - CreatedAt is the time when the upload was created.
+  - PhotoId is the Photo.PhotoId of the photo created once the upload is complete.
+*/
+type Upload struct {
+	UploadId  string `json:"uploadId"`
+	OwnerId   uint   `json:"ownerId"`
+	Length    int64  `json:"length"`
+	Offset    int64  `json:"offset"`
+	Metadata  string `json:"metadata"`
+	CreatedAt string `json:"createdAt"`
+	PhotoId   *uint  `json:"photoId,omitempty"`
+}
+
+/*
+Quota struct modeling the limits on the photos a user can upload. A limit of 0 means unlimited.
+  - MaxBytes is the maximum total size of the photos of the user, in bytes.
+  - MaxPhotos is the maximum number of photos of the user.
+  - MaxDailyBytes is the maximum total size of the photos uploaded by the user in a day (UTC), in bytes.
+  - MaxDailyPhotos is the maximum number of photos uploaded by the user in a day (UTC).
+*/
+type Quota struct {
+	MaxBytes       int64 `json:"maxBytes"`
+	MaxPhotos      int64 `json:"maxPhotos"`
+	MaxDailyBytes  int64 `json:"maxDailyBytes"`
+	MaxDailyPhotos int64 `json:"maxDailyPhotos"`
+}
+
+/*
+StorageUsage struct modeling the storage used by a user, along with their quota.
+  - Bytes is the total size of the photos and stories of the user, in bytes, including the length of their open uploads.
+  - Photos is the number of photos of the user, including archived and scheduled ones.
+  - DailyBytes is the total size of the photos and stories uploaded by the user today (UTC), in bytes.
+  - DailyPhotos is the number of photos uploaded by the user today (UTC), even if deleted since.
+  - Quota is the quota applied to the user.
+*/
+type StorageUsage struct {
+	Bytes       int64 `json:"bytes"`
+	Photos      int64 `json:"photos"`
+	DailyBytes  int64 `json:"dailyBytes"`
+	DailyPhotos int64 `json:"dailyPhotos"`
+	Quota       Quota `json:"quota"`
+}
+
+/*
+Page struct modeling the schema of a page of a list.
+  - Items is the list of elements in the page, whose type depends on the list.
+  - NextCursor is the opaque cursor to request the next page with, empty on the last page.
+*/
+type Page struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"nextCursor"`
 }
 
 /*
@@ -171,3 +474,131 @@ func (e *UsernameTakenError) Is(target error) bool {
 	}
 	return e.Username == t.Username
 }
+
+/*
+CommentNotFoundError whenever the db cannot find a comment with the given ID under a photo.
+  - CommentId is the comment ID that the db cannot find.
+*/
+type CommentNotFoundError struct {
+	CommentId uint
+}
+
+func (e *CommentNotFoundError) Error() string {
+	return fmt.Sprintf("Comment with ID `%d` not found", e.CommentId)
+}
+
+// InvalidCursorError whenever the cursor of a page of a list is malformed, or belongs to another list.
+type InvalidCursorError struct {
+	Cursor string
+}
+
+func (e *InvalidCursorError) Error() string {
+	return fmt.Sprintf("Invalid cursor `%s`", e.Cursor)
+}
+
+/*
+CollectionNotFoundError whenever the db cannot find a collection with the given ID among the ones of a user.
+  - CollectionId is the collection ID that the db cannot find.
+*/
+type CollectionNotFoundError struct {
+	CollectionId uint
+}
+
+func (e *CollectionNotFoundError) Error() string {
+	return fmt.Sprintf("Collection with ID `%d` not found", e.CollectionId)
+}
+
+/*
+CollectionNameTakenError whenever a request to create or rename a collection collides with another collection of the user.
+  - Name is the name already used by another collection.
+*/
+type CollectionNameTakenError struct {
+	Name string
+}
+
+func (e *CollectionNameTakenError) Error() string {
+	return fmt.Sprintf("Collection `%s` already exists", e.Name)
+}
+
+func (e *CollectionNameTakenError) Is(target error) bool {
+	var t *CollectionNameTakenError
+	ok := errors.As(target, &t)
+	if !ok {
+		return false
+	}
+	return e.Name == t.Name
+}
+
+/*
+StoryNotFoundError whenever the db cannot find an active story with the given ID.
+  - StoryId is the ID of the story.
+*/
+type StoryNotFoundError struct {
+	StoryId uint
+}
+
+func (e *StoryNotFoundError) Error() string {
+	return fmt.Sprintf("Story with ID `%d` not found", e.StoryId)
+}
+
+/*
+UploadNotFoundError whenever the db cannot find an upload with the given ID among the ones of a user.
+  - UploadId is the upload ID that the db cannot find.
+*/
+type UploadNotFoundError struct {
+	UploadId string
+}
+
+func (e *UploadNotFoundError) Error() string {
+	return fmt.Sprintf("Upload with ID `%s` not found", e.UploadId)
+}
+
+// TooManyUploadsError whenever a user creates an upload while they already have the maximum number of open ones.
+type TooManyUploadsError struct {
+	Max int
+}
+
+func (e *TooManyUploadsError) Error() string {
+	return fmt.Sprintf("Too many open uploads, at most %d can be open at once", e.Max)
+}
+
+// UploadOffsetMismatchError whenever a chunk is not appended at the current offset of an upload.
+type UploadOffsetMismatchError struct {
+	Offset int64
+}
+
+func (e *UploadOffsetMismatchError) Error() string {
+	return fmt.Sprintf("Upload offset mismatch, the current offset is %d", e.Offset)
+}
+
+/*
+QuotaExceededError whenever an upload would exceed one of the limits of the quota of a user.
+  - Limit is the name of the exceeded limit, as in the Quota JSON fields.
+  - Max is the value of the limit.
+  - Used is the current usage counted against the limit.
+  - Requested is the amount the upload would add to the usage.
+*/
+type QuotaExceededError struct {
+	Limit     string `json:"limit"`
+	Max       int64  `json:"max"`
+	Used      int64  `json:"used"`
+	Requested int64  `json:"requested"`
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("Quota exceeded: `%s` is %d, %d used and %d requested", e.Limit, e.Max, e.Used, e.Requested)
+}
+
+/*
+TagNotFoundError whenever the db cannot find the tag of a user in a photo.
+  - PhotoId is the ID of the photo.
+  - UserId is the ID of the user that is not tagged in the photo.
+*/
+type TagNotFoundError struct {
+	PhotoId uint
+	UserId  uint
+}
+
+func (e *TagNotFoundError) Error() string {
+	return fmt.Sprintf("User with ID `%d` is not tagged in the photo with ID `%d`", e.UserId, e.PhotoId)
+}